@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+const (
+	provenanceXattr   = "com.apple.provenance"
+	maclXattr         = "com.apple.macl"
+	execPolicyDB      = "/var/db/SystemPolicyConfiguration/ExecPolicy"
+	maclEntrySize     = 18
+	provenanceIDStart = 3
+)
+
+// Attributes the container manager puts on items in app sandbox containers.
+var sandboxXattrPrefixes = []string{"com.apple.containermanager.", "com.apple.sandbox."}
+
+// accessAttrReport tallies the attributes macOS uses to track which app
+// wrote a file or may open it, and with lookup set, which applications set
+// com.apple.provenance.
+type accessAttrReport struct {
+	lookup     bool
+	attrs      map[string]int
+	apps       map[string]int
+	provenance map[uint64]string
+	lookupErr  error
+}
+
+func newAccessAttrReport(lookup bool) *accessAttrReport {
+	return &accessAttrReport{lookup: lookup, attrs: map[string]int{}, apps: map[string]int{}, provenance: map[uint64]string{}}
+}
+
+// provenanceApp looks up the application that a provenance ID was assigned
+// to. The ExecPolicy database is only readable with Full Disk Access.
+func (r *accessAttrReport) provenanceApp(id uint64) string {
+	if app, ok := r.provenance[id]; ok {
+		return app
+	}
+	if r.lookupErr != nil {
+		return ""
+	}
+	defer timeCommand("sqlite3", time.Now())
+	out, err := exec.Command("sqlite3", "-readonly", execPolicyDB,
+		fmt.Sprintf("SELECT COALESCE(NULLIF(bundle_id, ''), signing_identifier, url) FROM provenance_tracking WHERE pk = %d", id)).CombinedOutput()
+	if err != nil {
+		r.lookupErr = fmt.Errorf("%s", strings.TrimSpace(string(out)))
+		return ""
+	}
+	app := strings.TrimSpace(string(out))
+	r.provenance[id] = app
+	return app
+}
+
+// maclGrants counts the non-empty app entries in a com.apple.macl value,
+// which is a list of two-byte headers followed by app UUIDs.
+func maclGrants(raw []byte) int {
+	grants := 0
+	for i := 0; i+maclEntrySize <= len(raw); i += maclEntrySize {
+		if !bytes.Equal(raw[i+2:i+maclEntrySize], make([]byte, 16)) {
+			grants++
+		}
+	}
+	return grants
+}
+
+// checkAccessAttrs reports provenance, sandbox container, and MACL
+// attributes. Provenance only identifies the app that wrote the file, but
+// MACL grants and container attributes tie access to this Mac: the apps
+// they name can be prompted again or refused once the file is copied or
+// moved out of the container.
+func (r *accessAttrReport) checkAccessAttrs(path string, attrs []string) (logs, warns []string) {
+	for _, attr := range attrs {
+		switch {
+		case attr == provenanceXattr:
+			r.attrs["provenance"]++
+			raw, err := xattr.Get(path, attr)
+			if err != nil {
+				warns = append(warns, fmt.Sprintf("Error: %s", err))
+				continue
+			}
+			if len(raw) < provenanceIDStart+8 {
+				logs = append(logs, "Provenance attribute (unrecognized format)")
+				continue
+			}
+			id := binary.LittleEndian.Uint64(raw[provenanceIDStart : provenanceIDStart+8])
+			if !r.lookup {
+				logs = append(logs, fmt.Sprintf("Provenance attribute (ID %d)", id))
+				continue
+			}
+			app := r.provenanceApp(id)
+			if app == "" {
+				app = "unknown app"
+			}
+			r.apps[app]++
+			logs = append(logs, fmt.Sprintf("Provenance attribute: written by %s (ID %d)", app, id))
+		case attr == maclXattr:
+			r.attrs["MACL"]++
+			raw, err := xattr.Get(path, attr)
+			if err != nil {
+				warns = append(warns, fmt.Sprintf("Error: %s", err))
+				continue
+			}
+			warns = append(warns, fmt.Sprintf("MACL attribute grants apps access to the file (%d apps); copies lose it, so those apps may prompt again or be refused access.", maclGrants(raw)))
+		default:
+			for _, prefix := range sandboxXattrPrefixes {
+				if strings.HasPrefix(attr, prefix) {
+					r.attrs["sandbox container"]++
+					warns = append(warns, fmt.Sprintf("App sandbox container attribute (%s); the owning app may not find the file once it's moved out of its container.", attr))
+					break
+				}
+			}
+		}
+	}
+	return logs, warns
+}
+
+func (r *accessAttrReport) print() {
+	fmt.Println("\nAccess-tracking attributes:")
+	for _, name := range sortedKeys(r.attrs) {
+		fmt.Printf("    %s: %d\n", name, r.attrs[name])
+	}
+	fmt.Println("com.apple.provenance records which app wrote a file; Gatekeeper uses it to check that app, and it causes no prompts.")
+	fmt.Println("com.apple.macl lists apps the user let open the file; it's protected by SIP, and copies lose it, so those apps may prompt again.")
+	fmt.Println("Sandbox container attributes tie items to an app's container; the app can't reach them after they're moved out.")
+	if !r.lookup {
+		return
+	}
+	if len(r.apps) > 0 {
+		fmt.Println("Provenance by application:")
+		for _, app := range sortedKeys(r.apps) {
+			fmt.Printf("    %s: %d\n", app, r.apps[app])
+		}
+	}
+	if r.lookupErr != nil {
+		fmt.Printf("Couldn't read %s (grant Full Disk Access or run as root): %s\n", execPolicyDB, r.lookupErr)
+	}
+}
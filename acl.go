@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// From sys/attr.h and sys/kauth.h. The ACL comes back as a kauth_filesec:
+// magic, owner and group GUIDs, entry count, flags, then the entries, each
+// an applicable GUID, flags, and rights.
+const (
+	attrCmnExtendedSecurity = 0x00400000
+	kauthFilesecMagic       = 0x012cc16d
+	kauthFilesecNoACL       = 0xffffffff
+	kauthACEKindMask        = 0xf
+	kauthACEDeny            = 2
+	kauthACEInherited       = 1 << 4
+	kauthFilesecHeaderSize  = 4 + 16 + 16 + 4 + 4
+	kauthACESize            = 16 + 4 + 4
+	aclBufSize              = 16 * 1024
+)
+
+// aclSummary describes the entries of a file's ACL.
+type aclSummary struct {
+	entries   int
+	deny      int
+	inherited int
+}
+
+// getACL reads a file's ACL, returning nil if it has none.
+func getACL(path string) (*aclSummary, error) {
+	attrs := attrList{bitmapCount: attrBitMapCount, commonAttr: attrCmnExtendedSecurity}
+	buf := make([]byte, aclBufSize)
+	if err := getattrlist(path, &attrs, buf, fsoptNoFollow); err != nil {
+		return nil, err
+	}
+	// an attrreference_t, relative to itself, follows the length
+	if binary.LittleEndian.Uint32(buf[0:4]) < 12 {
+		return nil, nil
+	}
+	offset := 4 + int(int32(binary.LittleEndian.Uint32(buf[4:8])))
+	length := int(binary.LittleEndian.Uint32(buf[8:12]))
+	if length < kauthFilesecHeaderSize || offset < 0 || offset+length > len(buf) {
+		return nil, nil
+	}
+	filesec := buf[offset : offset+length]
+	// the filesec is kept in disk (big-endian) order on some filesystems
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(filesec[0:4]) != kauthFilesecMagic {
+		order = binary.BigEndian
+		if order.Uint32(filesec[0:4]) != kauthFilesecMagic {
+			return nil, fmt.Errorf("unrecognized ACL format")
+		}
+	}
+	count := order.Uint32(filesec[36:40])
+	if count == kauthFilesecNoACL {
+		return nil, nil
+	}
+	acl := &aclSummary{}
+	for i := 0; i < int(count); i++ {
+		ace := kauthFilesecHeaderSize + i*kauthACESize
+		if ace+kauthACESize > len(filesec) {
+			break
+		}
+		flags := order.Uint32(filesec[ace+16 : ace+20])
+		acl.entries++
+		if flags&kauthACEKindMask == kauthACEDeny {
+			acl.deny++
+		}
+		if flags&kauthACEInherited != 0 {
+			acl.inherited++
+		}
+	}
+	return acl, nil
+}
+
+// aclReport tallies files and directories with ACLs.
+type aclReport struct {
+	objects   int
+	deny      int
+	inherited int
+}
+
+// checkACL reports ACLs, which few copy tools and no non-Mac targets keep,
+// and warns about deny entries, which can lock out even the owner.
+func (r *aclReport) checkACL(path string, info os.FileInfo) (logs, warns []string) {
+	acl, err := getACL(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error reading ACL: %s", err))
+	}
+	if acl == nil || acl.entries == 0 {
+		return logs, warns
+	}
+	r.objects++
+	if acl.inherited > 0 {
+		r.inherited++
+	}
+	logs = append(logs, fmt.Sprintf("ACL: %d entries (%d inherited)", acl.entries, acl.inherited))
+	if acl.deny > 0 {
+		r.deny++
+		warns = append(warns, fmt.Sprintf("ACL has deny entries (%d); access may be refused even where the mode bits allow it.", acl.deny))
+	}
+	return logs, warns
+}
+
+func (r *aclReport) print() {
+	fmt.Printf("\nACLs: %d files and directories (%d with deny entries, %d with inherited entries).\n", r.objects, r.deny, r.inherited)
+	fmt.Println("They are dropped by FAT and exFAT, cloud storage, most NAS shares, and cp or rsync without -E or -A.")
+}
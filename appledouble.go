@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/xattr"
+)
+
+const appleDoublePrefix = "._"
+const macOSXDir = "__MACOSX"
+
+const (
+	appleDoubleMagic        = 0x00051607
+	appleDoubleResourceFork = 2
+	appleDoubleFinderInfo   = 9
+	finderInfoLength        = 32
+)
+
+var appleDoubleAttrMagic = []byte("ATTR")
+
+// appleDouble holds the metadata stored in an AppleDouble (._) sidecar file.
+type appleDouble struct {
+	finderInfo   []byte
+	resourceFork []byte
+	xattrs       map[string][]byte
+	xattrNames   []string
+}
+
+func isAppleDoubleName(basename string) bool {
+	return strings.HasPrefix(basename, appleDoublePrefix) && len(basename) > len(appleDoublePrefix)
+}
+
+// appleDoubleDataPath returns the path of the file an AppleDouble sidecar describes.
+func appleDoubleDataPath(path string) string {
+	base := strings.TrimPrefix(filepath.Base(path), appleDoublePrefix)
+	return filepath.Join(filepath.Dir(path), base)
+}
+
+func readAppleDouble(path string) (*appleDouble, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseAppleDouble(data)
+}
+
+func parseAppleDouble(data []byte) (*appleDouble, error) {
+	if len(data) < 26 || binary.BigEndian.Uint32(data[0:4]) != appleDoubleMagic {
+		return nil, errors.New("not an AppleDouble file")
+	}
+	ad := &appleDouble{xattrs: map[string][]byte{}}
+	numEntries := int(binary.BigEndian.Uint16(data[24:26]))
+	for i := 0; i < numEntries; i++ {
+		start := 26 + i*12
+		if start+12 > len(data) {
+			return nil, errors.New("truncated AppleDouble entry table")
+		}
+		id := binary.BigEndian.Uint32(data[start : start+4])
+		offset := int(binary.BigEndian.Uint32(data[start+4 : start+8]))
+		length := int(binary.BigEndian.Uint32(data[start+8 : start+12]))
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("AppleDouble entry %d extends past end of file", id)
+		}
+		entry := data[offset : offset+length]
+		switch id {
+		case appleDoubleResourceFork:
+			ad.resourceFork = entry
+		case appleDoubleFinderInfo:
+			if len(entry) >= finderInfoLength {
+				ad.finderInfo = entry[:finderInfoLength]
+			}
+			// macOS stores xattrs in an extended Finder Info entry
+			if err := ad.parseAttrs(data, offset, length); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ad, nil
+}
+
+func (ad *appleDouble) parseAttrs(data []byte, entryOffset, entryLength int) error {
+	// 32 bytes Finder Info, 2 bytes padding, then the attribute header
+	const headerLength = 36
+	headerStart := entryOffset + finderInfoLength + 2
+	end := entryOffset + entryLength
+	if end < headerStart+headerLength || !bytes.Equal(data[headerStart:headerStart+4], appleDoubleAttrMagic) {
+		return nil
+	}
+	header := data[headerStart : headerStart+headerLength]
+	numAttrs := int(binary.BigEndian.Uint16(header[34:36]))
+	pos := headerStart + headerLength
+	for i := 0; i < numAttrs; i++ {
+		if pos+11 > end {
+			return errors.New("truncated AppleDouble attribute table")
+		}
+		offset := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		length := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		nameLen := int(data[pos+10])
+		if pos+11+nameLen > end || offset+length > len(data) {
+			return errors.New("truncated AppleDouble attribute")
+		}
+		name := strings.TrimRight(string(data[pos+11:pos+11+nameLen]), "\x00")
+		ad.xattrs[name] = data[offset : offset+length]
+		ad.xattrNames = append(ad.xattrNames, name)
+		// entries are aligned to 4 bytes from the start of the file
+		pos = (pos + 11 + nameLen + 3) &^ 3
+	}
+	return nil
+}
+
+func (ad *appleDouble) hasFinderInfo() bool {
+	return len(ad.finderInfo) > 0 && !bytes.Equal(ad.finderInfo, make([]byte, finderInfoLength))
+}
+
+// mergeInto writes the sidecar's metadata onto path as native xattrs,
+// journaling the values it replaces.
+func (ad *appleDouble) mergeInto(path string, undo *undoContext) error {
+	values := map[string][]byte{}
+	for _, name := range ad.xattrNames {
+		values[name] = ad.xattrs[name]
+	}
+	if ad.hasFinderInfo() {
+		values["com.apple.FinderInfo"] = ad.finderInfo
+	}
+	if len(ad.resourceFork) > 0 {
+		values["com.apple.ResourceFork"] = ad.resourceFork
+	}
+	return undo.setXattrs(path, values)
+}
+
+const (
+	appleDoubleOrphaned = "orphaned"
+	appleDoubleStale    = "stale"
+)
+
+// checkAppleDouble inspects an AppleDouble sidecar and reports its status:
+// "orphaned" when its data file is gone, "stale" when the data file has been
+// modified more recently than the sidecar, or "" otherwise. With undo set,
+// the sidecar is merged into native xattrs and moved to the quarantine area.
+func checkAppleDouble(path string, info os.FileInfo, undo *undoContext) (logs, warns []string, status string) {
+	dataPath := appleDoubleDataPath(path)
+	dataInfo, err := os.Lstat(dataPath)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Orphaned AppleDouble file; %s no longer exists.", filepath.Base(dataPath))), appleDoubleOrphaned
+	}
+	if dataInfo.ModTime().After(info.ModTime()) {
+		status = appleDoubleStale
+		warns = append(warns, fmt.Sprintf("Stale AppleDouble file; %s was modified more recently (%v vs. %v).", filepath.Base(dataPath), dataInfo.ModTime(), info.ModTime()))
+	}
+	ad, err := readAppleDouble(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err)), status
+	}
+	if len(ad.xattrNames) > 0 {
+		logs = append(logs, fmt.Sprintf("AppleDouble xattrs: %s", strings.Join(ad.xattrNames, ", ")))
+	}
+	if len(ad.resourceFork) > 0 {
+		logs = append(logs, fmt.Sprintf("AppleDouble resource fork: %d bytes", len(ad.resourceFork)))
+	}
+	if undo == nil {
+		return logs, append(warns, fmt.Sprintf("AppleDouble file holds metadata for '%s'.", filepath.Base(dataPath))), status
+	}
+	if err := ad.mergeInto(dataPath, undo); err != nil {
+		return logs, append(warns, fmt.Sprintf("Error merging AppleDouble file: %s", err)), status
+	}
+	if err := undo.remove(path); err != nil {
+		return logs, append(warns, fmt.Sprintf("Error removing AppleDouble file: %s", err)), status
+	}
+	return append(logs, fmt.Sprintf("Merged AppleDouble metadata into %s and removed sidecar", dataPath)), warns, status
+}
+
+// inspectMacOSXDir matches the AppleDouble entries in a __MACOSX folder with
+// the files they describe, which live at the same relative path next to it.
+func inspectMacOSXDir(path string) (logs, warns []string) {
+	parent := filepath.Dir(path)
+	matched := 0
+	orphaned := 0
+	filepath.Walk(path, func(entry string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || !isAppleDoubleName(info.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(path, appleDoubleDataPath(entry))
+		if err != nil {
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(parent, rel)); err != nil {
+			orphaned++
+			return nil
+		}
+		matched++
+		logs = append(logs, fmt.Sprintf("Metadata for %s", rel))
+		return nil
+	})
+	warns = append(warns, fmt.Sprintf("AppleDouble entries: %d describe existing files, %d have no matching file.", matched, orphaned))
+	return logs, warns
+}
+
+// encode serializes the metadata in the layout ditto uses for __MACOSX
+// entries: a Finder Info entry extended with the xattrs, then the resource
+// fork.
+func (ad *appleDouble) encode() []byte {
+	const headerLength = 26 + 2*12
+	const attrHeaderLength = 36
+	finderInfo := make([]byte, finderInfoLength)
+	copy(finderInfo, ad.finderInfo)
+
+	// attribute entries follow the attribute header, each aligned to 4 bytes
+	attrStart := headerLength + finderInfoLength + 2
+	pos := attrStart + attrHeaderLength
+	entryOffsets := make([]int, len(ad.xattrNames))
+	for i, name := range ad.xattrNames {
+		entryOffsets[i] = pos
+		pos = (pos + 11 + len(name) + 1 + 3) &^ 3
+	}
+	dataStart := pos
+	for _, name := range ad.xattrNames {
+		pos += len(ad.xattrs[name])
+	}
+	dataEnd := pos
+
+	buf := make([]byte, dataEnd, dataEnd+len(ad.resourceFork))
+	binary.BigEndian.PutUint32(buf[0:4], appleDoubleMagic)
+	binary.BigEndian.PutUint32(buf[4:8], 0x00020000)
+	copy(buf[8:24], "Mac OS X        ")
+	binary.BigEndian.PutUint16(buf[24:26], 2)
+	binary.BigEndian.PutUint32(buf[26:30], appleDoubleFinderInfo)
+	binary.BigEndian.PutUint32(buf[30:34], headerLength)
+	binary.BigEndian.PutUint32(buf[34:38], uint32(dataEnd-headerLength))
+	binary.BigEndian.PutUint32(buf[38:42], appleDoubleResourceFork)
+	binary.BigEndian.PutUint32(buf[42:46], uint32(dataEnd))
+	binary.BigEndian.PutUint32(buf[46:50], uint32(len(ad.resourceFork)))
+	copy(buf[headerLength:], finderInfo)
+
+	header := buf[attrStart : attrStart+attrHeaderLength]
+	copy(header[0:4], appleDoubleAttrMagic)
+	binary.BigEndian.PutUint32(header[8:12], uint32(dataEnd))
+	binary.BigEndian.PutUint32(header[12:16], uint32(dataStart))
+	binary.BigEndian.PutUint32(header[16:20], uint32(dataEnd-dataStart))
+	binary.BigEndian.PutUint16(header[34:36], uint16(len(ad.xattrNames)))
+	offset := dataStart
+	for i, name := range ad.xattrNames {
+		value := ad.xattrs[name]
+		entry := buf[entryOffsets[i]:]
+		binary.BigEndian.PutUint32(entry[0:4], uint32(offset))
+		binary.BigEndian.PutUint32(entry[4:8], uint32(len(value)))
+		entry[10] = byte(len(name) + 1)
+		copy(entry[11:], name)
+		copy(buf[offset:], value)
+		offset += len(value)
+	}
+	return append(buf, ad.resourceFork...)
+}
+
+// readNativeAppleDouble collects the Finder Info, resource fork, and other
+// xattrs of path, as they would be written to an AppleDouble file.
+func readNativeAppleDouble(path string) (*appleDouble, error) {
+	names, err := xattr.LList(path)
+	if err != nil {
+		return nil, err
+	}
+	ad := &appleDouble{xattrs: map[string][]byte{}}
+	for _, name := range names {
+		value, err := xattr.LGet(path, name)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "com.apple.FinderInfo":
+			ad.finderInfo = value
+		case "com.apple.ResourceFork":
+			ad.resourceFork = value
+		default:
+			ad.xattrs[name] = value
+			ad.xattrNames = append(ad.xattrNames, name)
+		}
+	}
+	return ad, nil
+}
+
+func (ad *appleDouble) isEmpty() bool {
+	return !ad.hasFinderInfo() && len(ad.resourceFork) == 0 && len(ad.xattrNames) == 0
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var tarArchiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tbz2"}
+
+// archiveMember holds the findings for one member of an archive. They are
+// reported as "archive.tar:/member/path".
+type archiveMember struct {
+	name  string
+	logs  []string
+	warns []string
+}
+
+func archiveMemberPath(archive, member string) string {
+	return archive + ":/" + strings.TrimPrefix(member, "/")
+}
+
+func isTarArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, suffix := range tarArchiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func openTarArchive(path string) (*tar.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	lower := strings.ToLower(path)
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		r = gz
+	case strings.HasSuffix(lower, ".bz2") || strings.HasSuffix(lower, ".tbz") || strings.HasSuffix(lower, ".tbz2"):
+		r = bzip2.NewReader(f)
+	}
+	return tar.NewReader(r), f, nil
+}
+
+// paxXattrs returns the xattr names recorded in a member's PAX records, as
+// written by GNU tar (SCHILY.xattr.*) and bsdtar (LIBARCHIVE.xattr.*).
+func paxXattrs(hdr *tar.Header) []string {
+	names := []string{}
+	for key := range hdr.PAXRecords {
+		for _, prefix := range []string{"SCHILY.xattr.", "LIBARCHIVE.xattr."} {
+			if strings.HasPrefix(key, prefix) {
+				names = append(names, strings.TrimPrefix(key, prefix))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// archiveMetadata counts the ways an archive holds Mac metadata that
+// non-Mac tools drop when extracting it.
+type archiveMetadata struct {
+	appleDouble int
+	xattrs      int
+	extraFields int
+}
+
+func (m archiveMetadata) any() bool {
+	return m.appleDouble+m.xattrs+m.extraFields > 0
+}
+
+// checkArchiveMember applies the naming rules to an archive member and notes
+// AppleDouble members and PaxHeaders left behind by tools that didn't
+// understand extended headers.
+func checkArchiveMember(name string, info os.FileInfo, metadata *archiveMetadata) archiveMember {
+	member := archiveMember{name: strings.TrimSuffix(name, "/")}
+	base := path.Base(member.name)
+	if info.Mode().IsRegular() && (isAppleDoubleName(base) || strings.HasPrefix(member.name, macOSXDir+"/")) {
+		metadata.appleDouble++
+		member.logs = append(member.logs, fmt.Sprintf("AppleDouble metadata for '%s'", strings.TrimPrefix(base, appleDoublePrefix)))
+		return member
+	}
+	if info.Mode().IsRegular() || info.IsDir() {
+		member.logs, member.warns = checkBasename(member.name, info, false)
+	}
+	for _, part := range strings.Split(member.name, "/") {
+		if strings.HasPrefix(part, "PaxHeader") {
+			member.warns = append(member.warns, "PaxHeaders member; the archive was repacked by a tool that didn't understand its extended headers.")
+			break
+		}
+	}
+	return member
+}
+
+func archiveSummary(kind string, count int, metadata archiveMetadata) (logs, warns []string) {
+	logs = append(logs, fmt.Sprintf("%s archive: %d members", kind, count))
+	if metadata.any() {
+		warns = append(warns, fmt.Sprintf("Archive holds Mac metadata (%d AppleDouble members, %d members with xattrs, %d Mac extra fields); it will be lost if extracted with non-Mac tools.",
+			metadata.appleDouble, metadata.xattrs, metadata.extraFields))
+	}
+	return logs, warns
+}
+
+// checkTarArchive checks the members of a tar archive, including the xattrs
+// archived in their PAX records.
+func checkTarArchive(path string) (logs, warns []string, members []archiveMember, metadata archiveMetadata) {
+	tr, closer, err := openTarArchive(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error reading archive: %s", err)), nil, metadata
+	}
+	defer closer.Close()
+
+	count := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			warns = append(warns, fmt.Sprintf("Error reading archive: %s", err))
+			break
+		}
+		count++
+		member := checkArchiveMember(hdr.Name, hdr.FileInfo(), &metadata)
+		if attrs := removeIgnoredXattrs(paxXattrs(hdr)); len(attrs) > 0 {
+			metadata.xattrs++
+			member.logs = append(member.logs, fmt.Sprintf("Archived xattrs: %s", strings.Join(attrs, ", ")))
+		}
+		if len(member.warns) > 0 || len(member.logs) > 0 {
+			members = append(members, member)
+		}
+	}
+	logs2, warns2 := archiveSummary("tar", count, metadata)
+	return append(logs, logs2...), append(warns, warns2...), members, metadata
+}
+
+// Zip extra field IDs written by Mac archivers to hold resource forks and
+// Finder info.
+var macZipExtraFields = map[uint16]string{
+	0x07c8: "Info-ZIP Macintosh",
+	0x334d: "Info-ZIP Macintosh",
+	0x2605: "ZipIt Macintosh",
+	0x2705: "ZipIt Macintosh",
+	0x2805: "ZipIt Macintosh",
+}
+
+func macZipExtraField(extra []byte) string {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if name, ok := macZipExtraFields[id]; ok {
+			return name
+		}
+		if 4+size > len(extra) {
+			break
+		}
+		extra = extra[4+size:]
+	}
+	return ""
+}
+
+func isZipArchive(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".zip"
+}
+
+// checkZipArchive checks the members of a zip archive, including Mac
+// metadata kept in __MACOSX entries or extra fields.
+func checkZipArchive(path string) (logs, warns []string, members []archiveMember, metadata archiveMetadata) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error reading archive: %s", err)), nil, metadata
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		member := checkArchiveMember(f.Name, f.FileInfo(), &metadata)
+		if name := macZipExtraField(f.Extra); name != "" {
+			metadata.extraFields++
+			member.logs = append(member.logs, fmt.Sprintf("Mac metadata in %s extra field", name))
+		}
+		if len(member.warns) > 0 || len(member.logs) > 0 {
+			members = append(members, member)
+		}
+	}
+	logs2, warns2 := archiveSummary("zip", len(zr.File), metadata)
+	return append(logs, logs2...), append(warns, warns2...), members, metadata
+}
+
+func isArchive(path string) bool {
+	return isTarArchive(path) || isZipArchive(path)
+}
+
+func checkArchive(path string) (logs, warns []string, members []archiveMember, metadata archiveMetadata) {
+	if isZipArchive(path) {
+		return checkZipArchive(path)
+	}
+	return checkTarArchive(path)
+}
+
+// scanArchiveMembers reports the members of an archive with findings as
+// paths of their own.
+func scanArchiveMembers(path string, members []archiveMember, emit func(path string, info os.FileInfo, errors, warns, logs []string)) {
+	for _, member := range members {
+		emit(archiveMemberPath(path, member.name), nil, []string{}, member.warns, member.logs)
+	}
+}
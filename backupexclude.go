@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+const backupExcludeXattr = "com.apple.metadata:com_apple_backup_excludeItem"
+
+type backupExclusion struct {
+	path string
+	size int64
+	dir  bool
+}
+
+// backupExclusionReport lists the items Time Machine skips because they
+// carry the sticky exclusion set by tmutil addexclusion or by the apps that
+// own them. Exclusions in the Time Machine preferences aren't included.
+type backupExclusionReport struct {
+	items []backupExclusion
+	total int64
+}
+
+// checkBackupExclusion records an item excluded from Time Machine, sizing
+// excluded directories as a whole. Items inside an excluded directory are
+// already counted with it.
+func (r *backupExclusionReport) checkBackupExclusion(path, displayPath string, info os.FileInfo, attrs []string) (logs, warns []string) {
+	if !containsString(attrs, backupExcludeXattr) {
+		return logs, warns
+	}
+	for _, item := range r.items {
+		if item.dir && isWithin(displayPath, item.path) {
+			return logs, warns
+		}
+	}
+	size := info.Size()
+	if info.IsDir() {
+		size, _ = dirSize(path)
+	}
+	r.items = append(r.items, backupExclusion{path: displayPath, size: size, dir: info.IsDir()})
+	r.total += size
+	return logs, append(warns, fmt.Sprintf("Excluded from Time Machine (%s); backups don't contain it.", formatBytes(size)))
+}
+
+func (r *backupExclusionReport) print() {
+	fmt.Printf("\nExcluded from Time Machine: %d items, %s.\n", len(r.items), formatBytes(r.total))
+	sort.Slice(r.items, func(i, j int) bool { return r.items[i].size > r.items[j].size })
+	for _, item := range r.items {
+		kind := "file"
+		if item.dir {
+			kind = "directory"
+		}
+		fmt.Printf("    %s  %s (%s)\n", formatBytes(item.size), item.path, kind)
+	}
+	fmt.Println("Remove an exclusion with 'tmutil removeexclusion <path>' if the item should be backed up.")
+}
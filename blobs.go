@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Virtual machine and disk images, which are opaque to the scan and usually
+// too big to sync to cloud storage.
+var largeImageExtensions = []string{".vmdk", ".vdi", ".qcow2", ".vhd", ".vhdx", ".hdd", ".dmg", ".sparseimage", ".iso", ".img"}
+
+// VM bundles are directories holding an image plus its configuration; they
+// are reported as single objects.
+var vmBundleExtensions = []string{".pvm", ".vmwarevm", ".utm"}
+
+func isVMBundle(path string, info os.FileInfo) bool {
+	return info.IsDir() && containsString(vmBundleExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+func isLargeImageCandidate(path string, info os.FileInfo) bool {
+	return info.Mode().IsRegular() && containsString(largeImageExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// largeBlob is an image over the size threshold, for the summary.
+type largeBlob struct {
+	path string
+	size int64
+}
+
+func checkLargeImage(path string, size, threshold int64, blobs *[]largeBlob) (logs, warns []string) {
+	if size < threshold {
+		return logs, warns
+	}
+	*blobs = append(*blobs, largeBlob{path, size})
+	return logs, append(warns, fmt.Sprintf("Large disk or VM image (%s); usually shouldn't be synced to cloud storage.", formatBytes(size)))
+}
+
+// checkVMBundle reports a VM bundle as one object. displayPath is what the
+// bundle is listed as in the summary.
+func checkVMBundle(path, displayPath string, threshold int64, blobs *[]largeBlob) (logs, warns []string, size int64) {
+	size, files := dirSize(path)
+	logs = append(logs, fmt.Sprintf("Virtual machine bundle: %d files, %s", files, formatBytes(size)))
+	logs2, warns2 := checkLargeImage(displayPath, size, threshold, blobs)
+	return append(logs, logs2...), append(warns, warns2...), size
+}
+
+func printLargeBlobs(blobs []largeBlob) {
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].size > blobs[j].size })
+	var total int64
+	for _, blob := range blobs {
+		total += blob.size
+	}
+	fmt.Printf("\nLarge opaque blobs: %d (%s)\n", len(blobs), formatBytes(total))
+	for _, blob := range blobs {
+		fmt.Printf("    %s  %s\n", formatBytes(blob.size), blob.path)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// BSD file flags from <sys/stat.h>
+const (
+	ufNoDump     = 0x00000001
+	ufImmutable  = 0x00000002
+	ufAppend     = 0x00000004
+	ufOpaque     = 0x00000008
+	ufCompressed = 0x00000020
+	ufHidden     = 0x00008000
+	sfArchived   = 0x00010000
+	sfImmutable  = 0x00020000
+	sfAppend     = 0x00040000
+	sfRestricted = 0x00080000
+	sfNoUnlink   = 0x00100000
+	sfDataless   = 0x40000000
+)
+
+// The flags reported by checkFileFlags, with their chflags names.
+// Compression is an implementation detail of the filesystem and isn't.
+var fileFlagNames = []struct {
+	flag uint32
+	name string
+}{
+	{ufNoDump, "nodump"},
+	{ufImmutable, "uchg"},
+	{ufAppend, "uappnd"},
+	{ufOpaque, "opaque"},
+	{ufHidden, "hidden"},
+	{sfArchived, "arch"},
+	{sfImmutable, "schg"},
+	{sfAppend, "sappnd"},
+	{sfRestricted, "restricted"},
+	{sfNoUnlink, "sunlnk"},
+}
+
+const fixUnlock = "unlock"
+
+func fileFlags(info os.FileInfo) uint32 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Flags
+	}
+	return 0
+}
+
+func isLocked(info os.FileInfo) bool {
+	return fileFlags(info)&ufImmutable != 0
+}
+
+// checkLocked reports files locked in the Finder (uchg), which makes copies
+// and renames fail.
+func checkLocked(path string, info os.FileInfo, attrs []string) (logs, warns []string) {
+	if isLocked(info) {
+		warns = append(warns, "Locked (uchg); copies and renames will fail with permission errors.")
+	}
+	return logs, warns
+}
+
+// checkFileFlags reports a file's BSD flags, counting each in counts. uchg
+// is warned about by checkLocked.
+func checkFileFlags(info os.FileInfo, counts map[string]int) (logs, warns []string) {
+	flags := fileFlags(info)
+	names := []string{}
+	for _, f := range fileFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+			counts[f.name]++
+		}
+	}
+	if len(names) == 0 {
+		return logs, warns
+	}
+	logs = append(logs, fmt.Sprintf("BSD flags: %s", strings.Join(names, ", ")))
+	if flags&(sfImmutable|sfAppend|sfNoUnlink|ufAppend) != 0 {
+		warns = append(warns, "System immutable or append-only flags (schg, sappnd, sunlnk, or uappnd); copies, renames, and removal will fail, and clearing them may need recovery mode.")
+	}
+	if flags&sfRestricted != 0 {
+		warns = append(warns, "Restricted by System Integrity Protection; it can't be modified or removed.")
+	}
+	if flags&ufHidden != 0 {
+		warns = append(warns, "Hidden flag; it won't survive copies to non-HFS/APFS targets, so the item will become visible.")
+	}
+	return logs, warns
+}
+
+// setFileFlag sets or clears one of a file's BSD flags.
+func setFileFlag(path string, flag uint32, on bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	flags := fileFlags(info) &^ flag
+	if on {
+		flags |= flag
+	}
+	return syscall.Chflags(path, int(flags))
+}
+
+func setLocked(path string, locked bool) error {
+	return setFileFlag(path, ufImmutable, locked)
+}
+
+// planUnlocks collects locked files and directories under dir.
+func planUnlocks(dir string) []fixAction {
+	actions := []fixAction{}
+	err := walkScannable(dir, func(path string, info os.FileInfo) error {
+		if isLocked(info) {
+			actions = append(actions, fixAction{
+				kind:    fixUnlock,
+				path:    path,
+				reason:  "locked",
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	check(err)
+	return actions
+}
+
+func describeUnlock(action fixAction) string {
+	return fmt.Sprintf("unlock %s", action.path)
+}
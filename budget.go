@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const budgetListLength = 10
+
+// sizeBudget totals the size of a tree against a destination quota.
+// Junk and other things that needn't be copied are tallied by category as
+// candidates for exclusion, and left out of the total if excludeJunk is set.
+type sizeBudget struct {
+	quota       int64
+	excludeJunk bool
+	total       int64
+	excluded    int64
+	topLevel    map[string]int64
+	largest     []largeBlob
+	excludable  map[string]int64
+}
+
+func newSizeBudget(quota int64, excludeJunk bool) *sizeBudget {
+	return &sizeBudget{
+		quota:       quota,
+		excludeJunk: excludeJunk,
+		topLevel:    map[string]int64{},
+		excludable:  map[string]int64{},
+	}
+}
+
+// add counts size bytes at rel, a path relative to the scanned directory.
+// category is the reason it could be left out of the copy, if any; junk
+// categories are prefixed "junk: ".
+func (b *sizeBudget) add(rel string, size int64, category string) {
+	if b.excludeJunk && strings.HasPrefix(category, "junk: ") {
+		b.excluded += size
+		return
+	}
+	b.total += size
+	b.topLevel[strings.SplitN(rel, "/", 2)[0]] += size
+	if category != "" {
+		b.excludable[category] += size
+	}
+	b.largest = append(b.largest, largeBlob{rel, size})
+	sort.Slice(b.largest, func(i, j int) bool { return b.largest[i].size > b.largest[j].size })
+	if len(b.largest) > budgetListLength {
+		b.largest = b.largest[:budgetListLength]
+	}
+}
+
+func (b *sizeBudget) print() {
+	fmt.Printf("\nBudget: %s of %s", formatBytes(b.total), formatBytes(b.quota))
+	if b.excluded > 0 {
+		fmt.Printf(" (%s of junk excluded)", formatBytes(b.excluded))
+	}
+	if b.total <= b.quota {
+		fmt.Printf("; fits with %s of headroom.\n", formatBytes(b.quota-b.total))
+	} else {
+		fmt.Printf("; over by %s.\n", formatBytes(b.total-b.quota))
+	}
+
+	names := make([]string, 0, len(b.topLevel))
+	for name := range b.topLevel {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return b.topLevel[names[i]] > b.topLevel[names[j]] })
+	if len(names) > budgetListLength {
+		names = names[:budgetListLength]
+	}
+	fmt.Println("    Largest top-level entries:")
+	for _, name := range names {
+		fmt.Printf("        %s  %s\n", formatBytes(b.topLevel[name]), name)
+	}
+	fmt.Println("    Largest files and bundles:")
+	for _, blob := range b.largest {
+		fmt.Printf("        %s  %s\n", formatBytes(blob.size), blob.path)
+	}
+
+	if len(b.excludable) == 0 {
+		return
+	}
+	categories := make([]string, 0, len(b.excludable))
+	for category := range b.excludable {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return b.excludable[categories[i]] > b.excludable[categories[j]] })
+	fmt.Println("    Could be excluded:")
+	remaining := b.total
+	for _, category := range categories {
+		remaining -= b.excludable[category]
+		fits := b.total > b.quota && remaining <= b.quota
+		note := ""
+		if fits {
+			note = "; fits"
+		}
+		fmt.Printf("        %s  %s (leaves %s%s)\n", formatBytes(b.excludable[category]), category, formatBytes(remaining), note)
+		if fits {
+			break
+		}
+	}
+}
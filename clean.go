@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultCleanLog = "weirdfs-clean.log"
+
+// A dry run must have been done for the same root and categories within this
+// window before clean will delete anything
+const cleanDryRunValidity = 24 * time.Hour
+
+// cleanCategory is a kind of junk the clean command can remove.
+type cleanCategory struct {
+	name        string
+	description string
+	match       func(path string, info os.FileInfo) bool
+}
+
+func cleanCategories() []cleanCategory {
+	categories := []cleanCategory{
+		{
+			name:        "dsstore",
+			description: "Finder .DS_Store file",
+			match: func(path string, info os.FileInfo) bool {
+				return info.Mode().IsRegular() && info.Name() == ".DS_Store"
+			},
+		},
+		{
+			name:        "appledouble",
+			description: "Orphaned AppleDouble (._) file",
+			match: func(path string, info os.FileInfo) bool {
+				if !info.Mode().IsRegular() || !isAppleDoubleName(info.Name()) {
+					return false
+				}
+				_, err := os.Lstat(appleDoubleDataPath(path))
+				return os.IsNotExist(err)
+			},
+		},
+	}
+	for _, junk := range junkCategories {
+		junk := junk
+		categories = append(categories, cleanCategory{
+			name:        junk.name,
+			description: junk.description,
+			match: func(path string, info os.FileInfo) bool {
+				return matchJunk(path, info) == junk
+			},
+		})
+	}
+	return categories
+}
+
+func cleanCategoryNames() string {
+	names := []string{}
+	for _, category := range cleanCategories() {
+		names = append(names, category.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// cleanDryRunMarker returns the path of the file recording that a dry run was
+// done for this root and set of categories.
+func cleanDryRunMarker(dir string, names []string) string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(dir + "|" + strings.Join(sorted, ",")))
+	return filepath.Join(os.TempDir(), "weirdfs-clean-"+hex.EncodeToString(sum[:8]))
+}
+
+type cleanItem struct {
+	path     string
+	category cleanCategory
+	size     int64
+}
+
+func findCleanItems(dir string, selected []cleanCategory) []cleanItem {
+	items := []cleanItem{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if isIgnoredPath(path) {
+			return nil
+		}
+		if err != nil {
+			fmt.Println(path)
+			log(err.Error(), "error")
+			return nil
+		}
+		for _, category := range selected {
+			if !category.match(path, info) {
+				continue
+			}
+			size := info.Size()
+			if info.IsDir() {
+				size, _ = dirSize(path)
+			}
+			items = append(items, cleanItem{path, category, size})
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return nil
+	})
+	check(err)
+	return items
+}
+
+func cleanCommand(args []string) {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	categoryList := flags.String("categories", "", "Comma-separated junk categories to remove (required): "+cleanCategoryNames())
+	deleteFiles := flags.Bool("delete", false, "Actually remove files; requires a dry run with the same categories first")
+	logPath := flags.String("log", defaultCleanLog, "Append removed paths to this log")
+	quarantine := flags.String("quarantine", "", "Move removed items here so 'weirdfs undo' can restore them (default: "+quarantineDirName+" under the root)")
+	purge := flags.Bool("purge", false, "Delete items permanently instead of moving them to the quarantine area")
+	journalPath := flags.String("journal", "", "Undo journal to append removals to (default: weirdfs-undo-<time>.jsonl)")
+	flags.Parse(args)
+
+	dir := scanRoot(flags.Arg(0))
+	names := splitList(strings.ToLower(*categoryList))
+	if len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "clean: -categories is required (%s)\n", cleanCategoryNames())
+		os.Exit(2)
+	}
+	selected := []cleanCategory{}
+	for _, name := range names {
+		found := false
+		for _, category := range cleanCategories() {
+			if category.name == name {
+				selected = append(selected, category)
+				found = true
+			}
+		}
+		if !found {
+			check(fmt.Errorf("unknown clean category '%s'", name))
+		}
+	}
+
+	marker := cleanDryRunMarker(dir, names)
+	if *deleteFiles {
+		markerInfo, err := os.Stat(marker)
+		if err != nil || time.Since(markerInfo.ModTime()) > cleanDryRunValidity {
+			fmt.Fprintln(os.Stderr, "clean: run without -delete first to review what will be removed")
+			os.Exit(1)
+		}
+	}
+
+	items := findCleanItems(dir, selected)
+	totals := map[string]*fileTally{}
+	var logFile *os.File
+	var journal *undoJournal
+	if *quarantine == "" {
+		*quarantine = filepath.Join(dir, quarantineDirName)
+	}
+	if *deleteFiles {
+		var err error
+		logFile, err = os.OpenFile(*logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		check(err)
+		defer logFile.Close()
+		if !*purge {
+			if *journalPath == "" {
+				*journalPath = defaultJournalPath()
+			}
+			journal = openUndoJournal(*journalPath)
+			defer journal.close()
+		}
+	}
+	failures := 0
+	for _, item := range items {
+		if *deleteFiles {
+			var err error
+			if *purge {
+				err = os.RemoveAll(item.path)
+			} else {
+				_, err = quarantinePath(dir, *quarantine, item.path, journal)
+			}
+			if err != nil {
+				fmt.Println(item.path)
+				log(err.Error(), "error")
+				failures++
+				continue
+			}
+			fmt.Fprintf(logFile, "%s\t%s\t%d\t%s\n", time.Now().Format(time.RFC3339), item.category.name, item.size, item.path)
+			fmt.Printf("Removed %s\n", item.path)
+		} else {
+			fmt.Printf("Would remove %s (%s, %s)\n", item.path, item.category.description, formatBytes(item.size))
+		}
+		if totals[item.category.name] == nil {
+			totals[item.category.name] = &fileTally{}
+		}
+		totals[item.category.name].add(item.size)
+	}
+
+	verb := "Would remove"
+	if *deleteFiles {
+		verb = "Removed"
+		os.Remove(marker)
+	} else {
+		check(ioutil.WriteFile(marker, []byte(dir), 0644))
+	}
+	fmt.Printf("\n%s:\n", verb)
+	for _, category := range selected {
+		tally := totals[category.name]
+		if tally == nil {
+			tally = &fileTally{}
+		}
+		fmt.Printf("    %s: %d items, %s\n", category.name, tally.count, formatBytes(tally.size))
+	}
+	if *deleteFiles {
+		fmt.Printf("%d failures. Deletions logged to %s\n", failures, *logPath)
+	} else {
+		fmt.Println("Dry run only. Re-run with -delete to remove these items.")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// From sys/attr.h. With FSOPT_ATTR_CMN_EXTENDED, the extended common
+// attributes are requested in the forkattr field of the attrlist.
+const (
+	attrBitMapCount        = 5
+	fsoptNoFollow          = 0x00000001
+	fsoptAttrCmnExtended   = 0x00000020
+	attrCmnExtPrivateSize  = 0x00000008
+	attrCmnExtCloneID      = 0x00000100
+	attrCmnExtExtFlags     = 0x00000200
+	extFlagMayShareBlocks  = 0x00000001
+	cloneAttributesBufSize = 4 + 8 + 8 + 8
+)
+
+type attrList struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32
+}
+
+// cloneInfo is what APFS knows about a file's shared storage: its clone
+// family and how many of its bytes no other file shares.
+type cloneInfo struct {
+	cloneID     uint64
+	privateSize int64
+	mayShare    bool
+}
+
+// getattrlist fills buf with the attributes requested by attrs.
+func getattrlist(path string, attrs *attrList, buf []byte, options uint32) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := syscall.Syscall6(
+		syscall.SYS_GETATTRLIST,
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(attrs)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		uintptr(options),
+		0,
+	); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getCloneInfo(path string) (*cloneInfo, error) {
+	attrs := attrList{
+		bitmapCount: attrBitMapCount,
+		forkAttr:    attrCmnExtPrivateSize | attrCmnExtCloneID | attrCmnExtExtFlags,
+	}
+	buf := make([]byte, cloneAttributesBufSize)
+	if err := getattrlist(path, &attrs, buf, fsoptNoFollow|fsoptAttrCmnExtended); err != nil {
+		if err == syscall.EINVAL || err == syscall.ENOTSUP {
+			// not supported by this filesystem
+			return nil, nil
+		}
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(buf[0:4]) < cloneAttributesBufSize {
+		// not supported by this filesystem
+		return nil, nil
+	}
+	return &cloneInfo{
+		privateSize: int64(binary.LittleEndian.Uint64(buf[4:12])),
+		cloneID:     binary.LittleEndian.Uint64(buf[12:20]),
+		mayShare:    binary.LittleEndian.Uint64(buf[20:28])&extFlagMayShareBlocks != 0,
+	}, nil
+}
+
+// cloneReport tallies files sharing storage with APFS clones.
+type cloneReport struct {
+	files    int
+	apparent int64
+	shared   int64
+	families map[uint64]int
+}
+
+// checkClone notes how much of a file's storage is shared with clones.
+func (r *cloneReport) checkClone(path string, info os.FileInfo) (logs, warns []string) {
+	if !info.Mode().IsRegular() || info.Size() == 0 {
+		return logs, warns
+	}
+	clone, err := getCloneInfo(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	if clone == nil || !clone.mayShare || clone.privateSize >= info.Size() {
+		return logs, warns
+	}
+	shared := info.Size() - clone.privateSize
+	if r.families == nil {
+		r.families = map[uint64]int{}
+	}
+	r.files++
+	r.apparent += info.Size()
+	r.shared += shared
+	r.families[clone.cloneID]++
+	return append(logs, fmt.Sprintf("APFS clone: shares %s of %s with other files", formatBytes(shared), formatBytes(info.Size()))), warns
+}
+
+func (r *cloneReport) print() {
+	fmt.Printf("\nAPFS clones: %d files in %d clone families share %s of their %s apparent size.\n",
+		r.files, len(r.families), formatBytes(r.shared), formatBytes(r.apparent))
+	fmt.Println("Copies to another volume, and most copy tools, write clones out in full, so the transfer will be larger than the space they use here.")
+}
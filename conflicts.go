@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Sync clients name conflicting copies after the original, e.g.
+// "foo (John's conflicted copy 2019-03-04).psd" or "foo (1).docx"
+var conflictedCopyName = regexp.MustCompile(`^(.+) \([^()]*conflicted copy[^()]*\)(\.[^. ]+)?$`)
+var numberedCopyName = regexp.MustCompile(`^(.+) \(\d+\)(\.[^. ]+)?$`)
+var dropboxTempName = regexp.MustCompile(`^\.sb-[0-9a-f]+-[A-Za-z0-9]+$`)
+
+const (
+	syncConflictedCopy = "conflicted copy"
+	syncNumberedCopy   = "numbered copy"
+	syncDropboxTemp    = "Dropbox temp file"
+)
+
+// syncConflictReport summarizes sync conflict artifacts found during a scan.
+type syncConflictReport struct {
+	kinds     map[string]*fileTally
+	identical int
+	orphaned  int
+}
+
+// syncConflictOriginal returns the kind of conflict artifact basename is and
+// the name of the file it is a copy of.
+func syncConflictOriginal(basename string) (kind, original string) {
+	if dropboxTempName.MatchString(basename) {
+		return syncDropboxTemp, ""
+	}
+	if match := conflictedCopyName.FindStringSubmatch(basename); match != nil {
+		return syncConflictedCopy, match[1] + match[2]
+	}
+	if match := numberedCopyName.FindStringSubmatch(basename); match != nil {
+		return syncNumberedCopy, match[1] + match[2]
+	}
+	return "", ""
+}
+
+// sameContents compares two files byte by byte.
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+func checkSyncConflict(path string, info os.FileInfo, report *syncConflictReport) (logs, warns []string) {
+	kind, original := syncConflictOriginal(filepath.Base(path))
+	if kind == "" {
+		return logs, warns
+	}
+	if report.kinds[kind] == nil {
+		report.kinds[kind] = &fileTally{}
+	}
+	report.kinds[kind].add(info.Size())
+	if kind == syncDropboxTemp {
+		return logs, append(warns, "Dropbox temporary file left behind by an interrupted sync.")
+	}
+
+	originalPath := filepath.Join(filepath.Dir(path), original)
+	originalInfo, err := os.Stat(originalPath)
+	if err != nil {
+		if kind == syncConflictedCopy {
+			report.orphaned++
+			warns = append(warns, fmt.Sprintf("Sync %s; original %s no longer exists.", kind, original))
+		}
+		return logs, warns
+	}
+	identical := false
+	if originalInfo.Mode().IsRegular() && originalInfo.Size() == info.Size() {
+		if identical, err = sameContents(path, originalPath); err != nil {
+			return logs, append(warns, fmt.Sprintf("Error: %s", err))
+		}
+	}
+	if identical {
+		report.identical++
+		return logs, append(warns, fmt.Sprintf("Sync %s of '%s'; contents are identical.", kind, original))
+	}
+	return logs, append(warns, fmt.Sprintf("Sync %s of '%s'; contents differ (%s vs. %s).", kind, original, formatBytes(info.Size()), formatBytes(originalInfo.Size())))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultStateDir holds daemon state: the latest report for each scanned
+// directory.
+func defaultStateDir() string {
+	usr, err := user.Current()
+	check(err)
+	return filepath.Join(usr.HomeDir, ".weirdfs", "daemon")
+}
+
+// stateReportPath names the saved report for dir after a hash of its path,
+// so directories with the same basename don't collide.
+func stateReportPath(stateDir, dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(stateDir, fmt.Sprintf("%s-%s.json", filepath.Base(dir), hex.EncodeToString(sum[:6])))
+}
+
+// runScan runs a full scan of dir in a child weirdfs process and returns its
+// report. The scan's own output is discarded unless debug is set.
+func runScan(dir string, scanFlags []string, debug bool) (*scanReport, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile("", "weirdfs-report")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	args := append(append([]string{}, scanFlags...), "-report", tmp.Name(), dir)
+	cmd := exec.Command(exe, args...)
+	if debug {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("scan of %s failed: %s", dir, err)
+	}
+	return readScanReport(tmp.Name()), nil
+}
+
+// daemonScan rescans dir, prints what changed since the previous scan, and
+// saves the new report as the baseline for the next one.
+func daemonScan(dir, stateDir string, scanFlags []string, debug bool, metrics *metricsRegistry, notify *notifier, sysLog *syslogSink) error {
+	report, err := runScan(dir, scanFlags, debug)
+	if err != nil {
+		return err
+	}
+	if metrics != nil {
+		metrics.recordScan(report)
+	}
+	statePath := stateReportPath(stateDir, dir)
+	fmt.Printf("\n%s: scanned %s: %d directories, %d files, %d scan errors\n",
+		time.Now().Format(time.RFC3339), dir, report.Dirs, report.Files, report.Errors)
+	if _, err := os.Stat(statePath); err == nil {
+		diff := diffReports(readScanReport(statePath), report)
+		if len(diff.newFindings) == 0 && len(diff.resolvedFindings) == 0 {
+			fmt.Println("No new or resolved findings.")
+		} else {
+			printFindingsByPath("New findings", diff.newFindings, "warn")
+			printFindingsByPath("Resolved findings", diff.resolvedFindings, "info")
+		}
+		for path, findings := range diff.newFindings {
+			errors, warns := []string{}, []string{}
+			entry := report.Entries[report.index[path]]
+			for _, msg := range findings {
+				if containsString(entry.Errors, msg) {
+					errors = append(errors, msg)
+				} else {
+					warns = append(warns, msg)
+				}
+			}
+			notify.add(path, errors, warns)
+			sysLog.send(dir, filepath.Join(dir, path), errors, warns)
+		}
+		notify.flush(fmt.Sprintf("weirdfs daemon scan of %s", dir), "new findings", statePath)
+	} else {
+		fmt.Printf("First scan; %d paths with findings recorded as the baseline.\n", len(reportFindings(report)))
+	}
+	return report.write(statePath)
+}
+
+// reportFindings returns the findings of every entry that has any, by path.
+func reportFindings(report *scanReport) map[string][]string {
+	findings := map[string][]string{}
+	for _, entry := range report.Entries {
+		if f := entry.findings(); len(f) > 0 {
+			findings[entry.Path] = f
+		}
+	}
+	return findings
+}
+
+func daemonCommand(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	interval := flags.Duration("interval", 6*time.Hour, "Time between scans")
+	stateDir := flags.String("state", defaultStateDir(), "Directory for the reports each scan is compared against")
+	scanFlags := flags.String("scanFlags", "", "Space-separated scan flags to use, e.g. '-reportRepos -reportTrash'")
+	once := flags.Bool("once", false, "Scan each directory once and exit (for running from cron or launchd)")
+	debug := flags.Bool("debug", false, "Show the output of each scan")
+	metricsAddr := flags.String("metrics", "", "Serve Prometheus metrics on /metrics at this address, e.g. ':9410'")
+	notify := addNotifyFlags(flags)
+	sysLog := addSyslogFlags(flags)
+	flags.Parse(args)
+	notify.checkLevel()
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs daemon [-interval 6h] [-state dir] [-scanFlags '...'] [-metrics addr] [-once] <dir>...")
+		os.Exit(2)
+	}
+	dirs := make([]string, flags.NArg())
+	for i, dir := range flags.Args() {
+		dirs[i] = scanRoot(dir)
+	}
+	check(os.MkdirAll(*stateDir, 0755))
+	sysLog.open()
+	defer sysLog.close()
+	var metrics *metricsRegistry
+	if *metricsAddr != "" {
+		metrics = newMetricsRegistry()
+		serveMetrics(*metricsAddr, metrics)
+	}
+
+	for {
+		started := time.Now()
+		for _, dir := range dirs {
+			if err := daemonScan(dir, *stateDir, strings.Fields(*scanFlags), *debug, metrics, notify, sysLog); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", time.Now().Format(time.RFC3339), err)
+			}
+		}
+		if *once {
+			return
+		}
+		next := started.Add(*interval)
+		fmt.Printf("\nNext scan at %s\n", next.Format(time.RFC3339))
+		time.Sleep(time.Until(next))
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func isDataless(info os.FileInfo) bool {
+	return fileFlags(info)&sfDataless != 0
+}
+
+// checkDataless warns about dataless files and directories: File Provider
+// placeholders (iCloud Drive, Dropbox, OneDrive) whose content isn't local.
+// Reading them triggers a download, so they are reported without being
+// checked further.
+func checkDataless(info os.FileInfo, tally *fileTally) (logs, warns []string) {
+	tally.add(info.Size())
+	if info.IsDir() {
+		return logs, append(warns, "Dataless directory (online-only placeholder); its contents aren't local and listing them triggers a download.")
+	}
+	return logs, append(warns, fmt.Sprintf("Dataless file (online-only placeholder, %s); its content isn't local, so copying it triggers a download or produces an empty file.", formatBytes(info.Size())))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var diskImageExtensions = []string{".dmg", ".sparseimage"}
+
+func isDiskImage(path string) bool {
+	return containsString(diskImageExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+func isSparseBundle(path string, info os.FileInfo) bool {
+	return info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".sparsebundle"
+}
+
+// sparseBundleSize reads the nominal size of a sparse bundle from the "size"
+// key of its Info.plist.
+func sparseBundleSize(path string) (int64, error) {
+	f, err := os.Open(filepath.Join(path, "Info.plist"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	decoder := xml.NewDecoder(f)
+	key := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, fmt.Errorf("no size in Info.plist: %s", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var text string
+		if start.Name.Local != "key" && start.Name.Local != "integer" {
+			if start.Name.Local != "dict" && start.Name.Local != "plist" {
+				key = ""
+			}
+			continue
+		}
+		if err := decoder.DecodeElement(&text, &start); err != nil {
+			return 0, err
+		}
+		if start.Name.Local == "key" {
+			key = text
+		} else if key == "size" {
+			var size int64
+			_, err := fmt.Sscanf(strings.TrimSpace(text), "%d", &size)
+			return size, err
+		}
+	}
+}
+
+// checkSparseBundle reports a sparse bundle as one object rather than as its
+// band files, and scans its contents if scanImages is set.
+func checkSparseBundle(path string, mounts imageMounts, walk filepath.WalkFunc, scanImages bool) (logs, warns []string, size int64) {
+	size, bands := dirSize(filepath.Join(path, "bands"))
+	nominal, err := sparseBundleSize(path)
+	if err != nil {
+		warns = append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	logs = append(logs, fmt.Sprintf("Sparse bundle: nominal size %s; %d band files using %s", formatBytes(nominal), bands, formatBytes(size)))
+	if scanImages {
+		logs2, warns2 := scanImage(path, mounts, walk)
+		logs = append(logs, logs2...)
+		warns = append(warns, warns2...)
+	}
+	return logs, warns, size
+}
+
+// attachImage mounts a disk image read-only at a new temporary directory,
+// without showing it in the Finder or verifying it first.
+func attachImage(path string) (string, error) {
+	defer timeCommand("hdiutil", time.Now())
+	mount, err := ioutil.TempDir("", "weirdfs-image")
+	if err != nil {
+		return "", err
+	}
+	// never wait on a password prompt: with -stdinpass, hdiutil reads the
+	// passphrase from stdin instead of asking in a dialog, so an encrypted
+	// image the encryption check missed fails on the empty input
+	cmd := exec.Command("hdiutil", "attach", "-readonly", "-nobrowse", "-noverify", "-noautoopen", "-stdinpass", "-mountpoint", mount, path)
+	cmd.Stdin = strings.NewReader("")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(mount)
+		return "", fmt.Errorf("hdiutil attach failed: %s", strings.TrimSpace(string(out)))
+	}
+	return mount, nil
+}
+
+func detachImage(mount string) error {
+	defer timeCommand("hdiutil", time.Now())
+	out, err := exec.Command("hdiutil", "detach", mount).CombinedOutput()
+	if err != nil {
+		out, err = exec.Command("hdiutil", "detach", "-force", mount).CombinedOutput()
+	}
+	if err != nil {
+		return fmt.Errorf("hdiutil detach failed: %s", strings.TrimSpace(string(out)))
+	}
+	os.Remove(mount)
+	return nil
+}
+
+// imageMounts maps the mount points of attached images to the image paths,
+// so findings inside them can be attributed as "image.dmg:/inner/path".
+type imageMounts map[string]string
+
+func (m imageMounts) displayPath(path string) string {
+	for mount, image := range m {
+		if path == mount {
+			return m.displayPath(image)
+		}
+		if strings.HasPrefix(path, mount+"/") {
+			return archiveMemberPath(m.displayPath(image), strings.TrimPrefix(path, mount+"/"))
+		}
+	}
+	return path
+}
+
+// rootOf returns the mount point of the image holding path, or root if
+// path isn't inside an attached image.
+func (m imageMounts) rootOf(path, root string) string {
+	for mount := range m {
+		if strings.HasPrefix(path, mount+"/") {
+			return mount
+		}
+	}
+	return root
+}
+
+// scanImage attaches an image, walks its contents with walk, and detaches it.
+func scanImage(path string, mounts imageMounts, walk filepath.WalkFunc) (logs, warns []string) {
+	mount, err := attachImage(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	mounts[mount] = path
+	defer delete(mounts, mount)
+	if err := filepath.Walk(mount, walk); err != nil {
+		warns = append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	if err := detachImage(mount); err != nil {
+		warns = append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	return logs, warns
+}
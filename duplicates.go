@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Suffixes people add when they version files by hand, e.g. "report copy 2",
+// "report FINAL2", "report (1)", "report_v3". Words need a separator before
+// them, so "gold" and "renew" are left alone.
+var versionSuffix = regexp.MustCompile(`(?i)([\s_-]+(copy(\s*\d+)?|final\d*|v\d+|old|new|backup|bak)|[\s_-]*\(\d+\))$`)
+
+// versionStem strips hand-versioning suffixes from a file name, keeping the
+// extension, so that variants of the same document map to the same stem.
+func versionStem(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	for {
+		stripped := versionSuffix.ReplaceAllString(stem, "")
+		if stripped == stem || stripped == "" {
+			break
+		}
+		stem = stripped
+	}
+	return stem + ext
+}
+
+// checkNearDuplicates clusters files in dir whose names differ only by
+// versioning suffixes.
+func checkNearDuplicates(dir string) (logs, warns []string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return logs, warns
+	}
+	clusters := map[string][]os.FileInfo{}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || isIgnoredFile(entry.Name()) {
+			continue
+		}
+		stem := versionStem(entry.Name())
+		clusters[stem] = append(clusters[stem], entry)
+	}
+
+	stems := make([]string, 0, len(clusters))
+	for stem, files := range clusters {
+		if len(files) > 1 {
+			stems = append(stems, stem)
+		}
+	}
+	sort.Strings(stems)
+	for _, stem := range stems {
+		files := clusters[stem]
+		sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+		descriptions := make([]string, len(files))
+		for i, file := range files {
+			descriptions[i] = fmt.Sprintf("'%s' (%s, %s)", file.Name(), formatBytes(file.Size()), file.ModTime().Format("2006-01-02 15:04"))
+		}
+		warns = append(warns, fmt.Sprintf("Near-duplicate names: %s", strings.Join(descriptions, ", ")))
+	}
+	return logs, warns
+}
+
+// checkDirEntries warns about directories with more than max entries, which
+// cripple the Finder, SMB enumeration, and most sync clients.
+func checkDirEntries(dir string, max int) (logs, warns []string) {
+	if max <= 0 {
+		return logs, warns
+	}
+	names, err := readDirNames(dir)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	if len(names) > max {
+		warns = append(warns, fmt.Sprintf("Large directory (%d entries, over %d); flat directories this big are slow to list in the Finder, over SMB, and in sync clients.", len(names), max))
+	}
+	return logs, warns
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const emptyFileListLength = 10
+
+// Files that are empty on purpose.
+var placeholderFileNames = []string{".gitkeep", ".keep", "__init__.py", ".nojekyll", ".localized"}
+
+// emptyFileReport tallies zero-byte regular files by extension and directory.
+type emptyFileReport struct {
+	count      int
+	extensions map[string]int
+	dirs       map[string]int
+}
+
+func newEmptyFileReport() *emptyFileReport {
+	return &emptyFileReport{extensions: map[string]int{}, dirs: map[string]int{}}
+}
+
+// checkEmptyFile flags zero-byte files, which often mean a transfer was
+// truncated. Files whose data is all in the resource fork are already
+// warned about by evaluateXattrs.
+func (r *emptyFileReport) checkEmptyFile(displayPath string, info os.FileInfo, attrs []string) (logs, warns []string) {
+	if !info.Mode().IsRegular() || info.Size() != 0 || containsString(attrs, "com.apple.ResourceFork") || containsString(placeholderFileNames, filepath.Base(displayPath)) {
+		return logs, warns
+	}
+	ext := strictFileExtension(displayPath)
+	if ext == "" {
+		ext = "(no extension)"
+	}
+	r.count++
+	r.extensions[ext]++
+	r.dirs[filepath.Dir(displayPath)]++
+	return logs, append(warns, "Zero-byte file; may be left by a truncated or failed transfer.")
+}
+
+// printTopCounts prints the n largest counts, largest first.
+func printTopCounts(counts map[string]int, n int) {
+	keys := sortedKeys(counts)
+	sort.SliceStable(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	for _, key := range keys {
+		fmt.Printf("        %s: %d\n", key, counts[key])
+	}
+}
+
+func (r *emptyFileReport) print() {
+	fmt.Printf("\nZero-byte files: %d\n", r.count)
+	fmt.Println("    By extension:")
+	printTopCounts(r.extensions, emptyFileListLength)
+	fmt.Println("    By directory:")
+	printTopCounts(r.dirs, emptyFileListLength)
+}
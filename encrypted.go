@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	encryptedImage      = "encrypted disk image"
+	encryptedBundle     = "encrypted sparse bundle"
+	encryptedContainer  = "possible VeraCrypt/TrueCrypt volume"
+	minVeraCryptVolume  = 292 * 1024
+	entropySampleLength = 64 * 1024
+)
+
+// Extensions VeraCrypt and TrueCrypt volumes usually have, if any.
+var encryptedContainerExtensions = []string{"", ".hc", ".tc", ".vc"}
+
+// readHeadTail reads up to headLength bytes from the start of a file and
+// tailLength from its end.
+func readHeadTail(path string, headLength, tailLength int64) (head, tail []byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	head = make([]byte, headLength)
+	read, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, err
+	}
+	head = head[:read]
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tailLength > 0 && info.Size() >= tailLength {
+		tail = make([]byte, tailLength)
+		if _, err := f.ReadAt(tail, info.Size()-tailLength); err != nil {
+			return nil, nil, err
+		}
+	}
+	return head, tail, nil
+}
+
+// byteEntropy returns the Shannon entropy of data in bits per byte; random or
+// encrypted data is close to 8.
+func byteEntropy(data []byte) float64 {
+	counts := [256]int{}
+	for _, b := range data {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// encryptedKind identifies encrypted disk images by their "encrcdsa" header
+// (or the "cdsaencr" trailer of version 1 images), and guesses at VeraCrypt or
+// TrueCrypt volumes, which have no header: a sector-aligned file with no
+// known format whose content is indistinguishable from random data.
+func encryptedKind(path string, info os.FileInfo) string {
+	if isSparseBundle(path, info) {
+		token := make([]byte, 8)
+		if f, err := os.Open(filepath.Join(path, "token")); err == nil {
+			defer f.Close()
+			if _, err := io.ReadFull(f, token); err == nil && string(token) == "encrcdsa" {
+				return encryptedBundle
+			}
+		}
+		return ""
+	}
+	if !info.Mode().IsRegular() || info.Size() < 8 {
+		return ""
+	}
+	if isDiskImage(path) {
+		head, tail, err := readHeadTail(path, 8, 8)
+		if err == nil && (bytes.Equal(head, []byte("encrcdsa")) || bytes.Equal(tail, []byte("cdsaencr"))) {
+			return encryptedImage
+		}
+		return ""
+	}
+	// check the cheap things before reading a sample of every extensionless
+	// file
+	if !containsString(encryptedContainerExtensions, strictFileExtension(path)) ||
+		info.Size() < minVeraCryptVolume || info.Size()%512 != 0 {
+		return ""
+	}
+	if magic, _ := sniffExtension(path); magic != "" {
+		return ""
+	}
+	head, _, err := readHeadTail(path, entropySampleLength, 0)
+	switch {
+	case err != nil:
+		return ""
+	case bytes.HasPrefix(head, []byte("encrcdsa")):
+		return encryptedImage
+	case byteEntropy(head) > 7.99:
+		return encryptedContainer
+	}
+	return ""
+}
+
+func checkEncrypted(path string, info os.FileInfo) (logs, warns []string, kind string) {
+	kind = encryptedKind(path, info)
+	switch kind {
+	case encryptedImage, encryptedBundle:
+		warns = append(warns, "Encrypted disk image; its contents can't be audited or migrated without the password.")
+	case encryptedContainer:
+		warns = append(warns, "Possible VeraCrypt/TrueCrypt volume (random-looking content with no known format); its contents can't be audited or migrated without the password.")
+	}
+	return logs, warns, kind
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Volume metadata that shouldn't be copied to another disk.
+var volumeMetadataExcludes = []excludePattern{
+	{pattern: ".DS_Store"},
+	{pattern: ".fseventsd", dir: true},
+	{pattern: ".Spotlight-V100", dir: true},
+	{pattern: ".Trashes", dir: true},
+	{pattern: ".TemporaryItems", dir: true},
+}
+
+var excludeFormats = []string{"rsync", "gitignore", "dropboxignore", "onedrive"}
+
+// excludePattern is a base name pattern, or with anchored set, a path
+// relative to the root of the transfer.
+type excludePattern struct {
+	pattern    string
+	dir        bool
+	ignoreCase bool
+	anchored   bool
+}
+
+// filterPattern formats a pattern for rsync filters and gitignore files,
+// which share a syntax for what weirdfs needs. Neither can match case
+// insensitively, so each letter becomes a bracket expression instead.
+func (p excludePattern) filterPattern() string {
+	pattern := p.pattern
+	if p.anchored {
+		var b strings.Builder
+		for i, r := range pattern {
+			if strings.ContainsRune(`*?[\`, r) || (i == 0 && strings.ContainsRune("#!", r)) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+		pattern = "/" + b.String()
+	} else if p.ignoreCase {
+		var b strings.Builder
+		inBrackets := false
+		for _, r := range pattern {
+			switch {
+			case r == '[':
+				inBrackets = true
+				b.WriteRune(r)
+			case r == ']':
+				inBrackets = false
+				b.WriteRune(r)
+			case !inBrackets && unicode.IsLetter(r) && unicode.ToUpper(r) != unicode.ToLower(r):
+				fmt.Fprintf(&b, "[%c%c]", unicode.ToLower(r), unicode.ToUpper(r))
+			default:
+				b.WriteRune(r)
+			}
+		}
+		pattern = b.String()
+	}
+	if p.dir {
+		pattern += "/"
+	}
+	return pattern
+}
+
+// excludeList is a set of exclude patterns grouped under the reason for
+// excluding them, in the order the groups were added.
+type excludeList struct {
+	groups   []string
+	patterns map[string][]excludePattern
+}
+
+func (l *excludeList) add(group string, patterns ...excludePattern) {
+	if len(patterns) == 0 {
+		return
+	}
+	if l.patterns == nil {
+		l.patterns = map[string][]excludePattern{}
+	}
+	if _, ok := l.patterns[group]; !ok {
+		l.groups = append(l.groups, group)
+	}
+	l.patterns[group] = append(l.patterns[group], patterns...)
+}
+
+// writeFilters writes the list as an rsync --exclude-from file or a
+// .gitignore; .dropboxignore files use the .gitignore syntax.
+func (l *excludeList) writeFilters(w io.Writer, header string) error {
+	fmt.Fprintf(w, "# Generated by weirdfs export-excludes; %s\n", header)
+	for _, group := range l.groups {
+		fmt.Fprintf(w, "\n# %s\n", group)
+		for _, pattern := range l.patterns[group] {
+			if _, err := fmt.Fprintln(w, pattern.filterPattern()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeOneDrive writes the list as the EnableODIgnore array of the OneDrive
+// preferences, for a configuration profile. OneDrive matches only file
+// names, case insensitively, so directories and paths are left out.
+func (l *excludeList) writeOneDrive(w io.Writer) error {
+	fmt.Fprintln(w, "<!-- Generated by weirdfs export-excludes; add to the com.microsoft.OneDrive preferences -->")
+	fmt.Fprintln(w, "<key>EnableODIgnore</key>")
+	fmt.Fprintln(w, "<array>")
+	skipped := 0
+	for _, group := range l.groups {
+		fmt.Fprintf(w, "\t<!-- %s -->\n", strings.Replace(group, "--", "-", -1))
+		for _, pattern := range l.patterns[group] {
+			if pattern.dir || pattern.anchored {
+				skipped++
+				continue
+			}
+			fmt.Fprint(w, "\t<string>")
+			xml.EscapeText(w, []byte(pattern.pattern))
+			fmt.Fprintln(w, "</string>")
+		}
+	}
+	_, err := fmt.Fprintln(w, "</array>")
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Left out %d directory and path patterns, which OneDrive can't exclude\n", skipped)
+	}
+	return err
+}
+
+// reportExcludes returns the paths in a report with a finding whose rule
+// contains one of rules, or that are files of at least largerThan bytes if
+// it isn't 0. Archive and image members can't be excluded on their own and
+// are left out.
+func reportExcludes(report *scanReport, rules []string, largerThan int64) (flagged, large []excludePattern) {
+	for _, entry := range report.Entries {
+		if strings.Contains(entry.Path, ":/") {
+			continue
+		}
+		pattern := excludePattern{pattern: entry.Path, dir: entry.Dir, anchored: true}
+		if largerThan > 0 && !entry.Dir && entry.Size >= largerThan {
+			large = append(large, pattern)
+			continue
+		}
+	findings:
+		for _, msg := range entry.findings() {
+			for _, rule := range rules {
+				if strings.Contains(strings.ToLower(findingRule(msg)), strings.ToLower(rule)) {
+					flagged = append(flagged, pattern)
+					break findings
+				}
+			}
+		}
+	}
+	sort.Slice(flagged, func(i, j int) bool { return flagged[i].pattern < flagged[j].pattern })
+	sort.Slice(large, func(i, j int) bool { return large[i].pattern < large[j].pattern })
+	return flagged, large
+}
+
+func exportExcludesCommand(args []string) {
+	flags := flag.NewFlagSet("export-excludes", flag.ExitOnError)
+	format := flags.String("format", "rsync", "Format of the exclude file: "+strings.Join(excludeFormats, ", "))
+	output := flags.String("output", "", "Path of the exclude file to write (default: standard output)")
+	categories := flags.String("categories", "", "Comma-separated junk categories to exclude (default: all): "+junkCategoryNames())
+	ignorePatterns := flags.String("ignore", "", "Comma-separated file or directory name patterns to exclude, as passed to the scan's -ignore")
+	buildDirs := flags.String("buildDirs", strings.Join(defaultBuildArtifactDirs, ","), "Comma-separated directory name patterns treated as regenerable build artifacts")
+	rules := flags.String("rule", "", "With a report, also exclude paths with a finding whose rule contains one of these comma-separated texts, e.g. 'Encrypted disk image,Large disk or VM image'")
+	largerThan := flags.String("largerThan", "", "With a report, also exclude files of at least this size, e.g. '2GB'")
+	flags.Parse(args)
+	if flags.NArg() > 1 || ((*rules != "" || *largerThan != "") && flags.NArg() == 0) {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs export-excludes [-format rsync|gitignore|dropboxignore|onedrive] [-output file] [-categories ...] [-ignore patterns] [-rule text] [-largerThan size] [report.json]")
+		os.Exit(2)
+	}
+	if !containsString(excludeFormats, *format) {
+		check(fmt.Errorf("unknown format '%s'", *format))
+	}
+	var minSize int64
+	if *largerThan != "" {
+		var err error
+		minSize, err = parseBytes(*largerThan)
+		check(err)
+	}
+	setJunkPatterns("build", *buildDirs)
+
+	excludes := &excludeList{}
+	excludes.add("Volume metadata", volumeMetadataExcludes...)
+	ignored := []excludePattern{}
+	for _, pattern := range splitList(*ignorePatterns) {
+		ignored = append(ignored, excludePattern{pattern: pattern})
+	}
+	excludes.add("Ignored paths", ignored...)
+
+	selected := parseJunkCategories(*categories)
+	for _, category := range junkCategories {
+		if len(selected) > 0 && !selected[category.name] {
+			continue
+		}
+		patterns := []excludePattern{}
+		for _, pattern := range category.dirs {
+			if _, ok := buildArtifactMarkers[pattern]; ok && category.name == "build" {
+				// a name pattern can't require the project file beside it
+				fmt.Fprintf(os.Stderr, "Left out '%s', which is only build output beside its project file\n", pattern)
+				continue
+			}
+			patterns = append(patterns, excludePattern{pattern: pattern, dir: true, ignoreCase: category.ignoreCase})
+		}
+		for _, pattern := range category.files {
+			patterns = append(patterns, excludePattern{pattern: pattern, ignoreCase: category.ignoreCase})
+		}
+		excludes.add(fmt.Sprintf("%s (%s)", category.description, category.name), patterns...)
+	}
+
+	if flags.NArg() == 1 {
+		report := readScanReport(flags.Arg(0))
+		flagged, large := reportExcludes(report, splitList(*rules), minSize)
+		excludes.add(fmt.Sprintf("Flagged in %s: %s", flags.Arg(0), *rules), flagged...)
+		excludes.add(fmt.Sprintf("Files of %s or more in %s", formatBytes(minSize), flags.Arg(0)), large...)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		check(err)
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "rsync":
+		check(excludes.writeFilters(w, "use with rsync --exclude-from"))
+	case "gitignore":
+		check(excludes.writeFilters(w, "save as .gitignore at the root of the repository"))
+	case "dropboxignore":
+		check(excludes.writeFilters(w, "save as .dropboxignore at the root of the folder to sync"))
+	case "onedrive":
+		check(excludes.writeOneDrive(w))
+	}
+	if *output != "" {
+		fmt.Printf("Wrote %s excludes to %s\n", *format, *output)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// exportRecords writes records to output as JSON, or the equivalent rows as
+// CSV with the given header.
+func exportRecords(output, format string, records interface{}, header []string, rows [][]string) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == "json" {
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(data, '\n'))
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(header)
+	w.WriteAll(rows)
+	return w.Error()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const missingExtensionReason = "missing extension"
+
+// Classic Mac OS type codes and the extensions modern systems expect
+var defaultTypeCodeExtensions = map[string]string{
+	"8BPS": ".psd",
+	"AIFF": ".aif",
+	"AIFC": ".aifc",
+	"BMPf": ".bmp",
+	"EPSF": ".eps",
+	"GIFf": ".gif",
+	"JPEG": ".jpg",
+	"MPG3": ".mp3",
+	"MooV": ".mov",
+	"PDF ": ".pdf",
+	"PICT": ".pict",
+	"PNGf": ".png",
+	"RTF ": ".rtf",
+	"SIT!": ".sit",
+	"SITD": ".sit",
+	"SLD8": ".ppt",
+	"Sd2f": ".sd2",
+	"TEXT": ".txt",
+	"TIFF": ".tif",
+	"W6BN": ".doc",
+	"W8BN": ".doc",
+	"WAVE": ".wav",
+	"WDBN": ".doc",
+	"XLS8": ".xls",
+	"ZIP ": ".zip",
+	"clpt": ".textclipping",
+}
+
+// magicExtension maps leading bytes (at offset) of a file's content to an
+// extension.
+type magicExtension struct {
+	offset int
+	magic  string
+	ext    string
+	name   string
+}
+
+var magicExtensions = []magicExtension{
+	{0, "%PDF", ".pdf", "PDF"},
+	{0, "\xFF\xD8\xFF", ".jpg", "JPEG"},
+	{0, "\x89PNG\r\n\x1a\n", ".png", "PNG"},
+	{0, "GIF8", ".gif", "GIF"},
+	{0, "II*\x00", ".tif", "TIFF"},
+	{0, "MM\x00*", ".tif", "TIFF"},
+	{0, "8BPS", ".psd", "Photoshop"},
+	{0, "{\\rtf", ".rtf", "RTF"},
+	{0, "%!PS", ".eps", "PostScript"},
+	{0, "ID3", ".mp3", "MP3"},
+	{0, "PK\x03\x04", ".zip", "ZIP"},
+	{0, "StuffIt!", ".sitx", "StuffIt X"},
+	{0, "StuffIt", ".sit", "StuffIt"},
+	{0, "SIT!", ".sit", "StuffIt"},
+	{0, "(This file must be converted with BinHex", ".hqx", "BinHex"},
+	{0, "bplist00", ".plist", "binary plist"},
+	{0, "<?xml", ".xml", "XML"},
+	{0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", ".doc", "OLE2 (Office 97-2003)"},
+	{4, "ftypqt", ".mov", "QuickTime"},
+	{4, "ftypM4A", ".m4a", "MPEG-4 audio"},
+	{4, "ftyp", ".mp4", "MPEG-4"},
+	{8, "AIFF", ".aif", "AIFF"},
+	{8, "WAVE", ".wav", "WAVE"},
+	{8, "AVI ", ".avi", "AVI"},
+}
+
+// loadTypeCodeExtensions reads a user-editable JSON map of type codes to
+// extensions, falling back to the defaults.
+func loadTypeCodeExtensions(path string) map[string]string {
+	if path == "" {
+		return defaultTypeCodeExtensions
+	}
+	data, err := ioutil.ReadFile(path)
+	check(err)
+	mapping := map[string]string{}
+	check(json.Unmarshal(data, &mapping))
+	return mapping
+}
+
+func writeTypeCodeExtensions(path string) {
+	data, err := json.MarshalIndent(defaultTypeCodeExtensions, "", "  ")
+	check(err)
+	check(ioutil.WriteFile(path, append(data, '\n'), 0644))
+}
+
+func sniffExtension(path string) (ext, name string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+	head := make([]byte, 64)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	for _, m := range magicExtensions {
+		if len(head) >= m.offset+len(m.magic) && bytes.Equal(head[m.offset:m.offset+len(m.magic)], []byte(m.magic)) {
+			return m.ext, m.name
+		}
+	}
+	return "", ""
+}
+
+// inferExtension guesses an extension for a file from its FinderInfo type code,
+// then from its content.
+func inferExtension(path string, typeCodes map[string]string) (ext, source string) {
+	if fi, err := readFinderInfo(path, false); err == nil && fi.hasTypeCode() {
+		if ext, ok := typeCodes[fi.fileType]; ok {
+			return ext, fmt.Sprintf("type '%s'", fi.fileType)
+		}
+	}
+	if ext, name := sniffExtension(path); ext != "" {
+		return ext, fmt.Sprintf("content looks like %s", name)
+	}
+	return "", ""
+}
+
+func addMissingExtensions(typeCodes map[string]string) renameRule {
+	return func(path, base string, info os.FileInfo) (string, string) {
+		if !info.Mode().IsRegular() || strictFileExtension(base) != "" ||
+			isAppleDoubleName(base) || containsString(defaultAllowedNamesWithoutFileExtension, base) {
+			return "", ""
+		}
+		ext, source := inferExtension(path, typeCodes)
+		if ext == "" {
+			return "", ""
+		}
+		return base + ext, fmt.Sprintf("%s (%s)", missingExtensionReason, source)
+	}
+}
+
+// extensionGroup returns the part of a fix reason describing an inferred
+// extension, which is what confirmation is grouped by.
+func extensionGroup(reason string) string {
+	if i := strings.Index(reason, missingExtensionReason); i > -1 {
+		group := reason[i:]
+		if j := strings.Index(group, ")"); j > -1 {
+			group = group[:j+1]
+		}
+		return group
+	}
+	return ""
+}
+
+// confirmExtensionGroups asks once per inferred type whether to add the
+// extension, and returns the actions that were confirmed. Renames in a
+// declined group are proposed again with nameRules, the other rename rules,
+// so that the other fixes they made to the name are kept.
+func confirmExtensionGroups(actions []fixAction, nameRules []renameRule) []fixAction {
+	groups := map[string][]fixAction{}
+	for _, action := range actions {
+		if group := extensionGroup(action.reason); group != "" {
+			groups[group] = append(groups[group], action)
+		}
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	in := bufio.NewReader(os.Stdin)
+	declined := map[string]bool{}
+	for _, name := range names {
+		group := groups[name]
+		fmt.Printf("%s: %d files, e.g. %s -> %s. Apply? [y/N] ", name, len(group), filepath.Base(group[0].path), filepath.Base(group[0].newPath))
+		answer, _ := in.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			declined[name] = true
+		}
+	}
+	taken := map[string]bool{}
+	for _, action := range actions {
+		if action.kind == fixRename && !declined[extensionGroup(action.reason)] {
+			taken[foldCaseNFC(action.newPath)] = true
+		}
+	}
+	confirmed := []fixAction{}
+	for _, action := range actions {
+		if !declined[extensionGroup(action.reason)] {
+			confirmed = append(confirmed, action)
+			continue
+		}
+		info, err := os.Lstat(action.path)
+		if err != nil {
+			continue
+		}
+		if renamed := proposeRename(action.path, info, nameRules, taken); renamed != nil {
+			confirmed = append(confirmed, *renamed)
+		}
+	}
+	return confirmed
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const noExtension = "(no extension)"
+
+var extensionSortColumns = []string{"extension", "files", "bytes", "min", "max", "median", "warnings"}
+
+// extensionStat summarizes the files with one extension.
+type extensionStat struct {
+	Extension string `json:"extension"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	Min       int64  `json:"min"`
+	Max       int64  `json:"max"`
+	Median    int64  `json:"median"`
+	Warnings  int    `json:"warnings"`
+	sizes     []int64
+}
+
+type extensionStats map[string]*extensionStat
+
+func extensionLabel(path string) string {
+	if ext := strictFileExtension(path); ext != "" {
+		return ext
+	}
+	return noExtension
+}
+
+func (s extensionStats) add(path string, size int64) {
+	ext := extensionLabel(path)
+	stat := s[ext]
+	if stat == nil {
+		stat = &extensionStat{Extension: ext, Min: size}
+		s[ext] = stat
+	}
+	stat.Files++
+	stat.Bytes += size
+	if size < stat.Min {
+		stat.Min = size
+	}
+	if size > stat.Max {
+		stat.Max = size
+	}
+	stat.sizes = append(stat.sizes, size)
+}
+
+// addWarnings counts the findings on a file against its extension. Files
+// that weren't counted, like archive members, are left out.
+func (s extensionStats) addWarnings(path string, count int) {
+	if stat := s[extensionLabel(path)]; stat != nil {
+		stat.Warnings += count
+	}
+}
+
+// table returns the statistics sorted by column, largest first except for
+// the extension itself.
+func (s extensionStats) table(column string) []extensionStat {
+	rows := make([]extensionStat, 0, len(s))
+	for _, stat := range s {
+		sort.Slice(stat.sizes, func(i, j int) bool { return stat.sizes[i] < stat.sizes[j] })
+		stat.Median = stat.sizes[len(stat.sizes)/2]
+		rows = append(rows, *stat)
+	}
+	value := func(stat extensionStat) int64 {
+		switch column {
+		case "files":
+			return int64(stat.Files)
+		case "min":
+			return stat.Min
+		case "max":
+			return stat.Max
+		case "median":
+			return stat.Median
+		case "warnings":
+			return int64(stat.Warnings)
+		}
+		return stat.Bytes
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if column == "extension" || value(rows[i]) == value(rows[j]) {
+			return rows[i].Extension < rows[j].Extension
+		}
+		return value(rows[i]) > value(rows[j])
+	})
+	return rows
+}
+
+func printExtensionStats(rows []extensionStat) {
+	fmt.Println("\nFile extensions encountered (lowercased):")
+	fmt.Printf("    %-16s %9s %10s %10s %10s %10s %9s\n", "extension", "files", "bytes", "min", "median", "max", "warnings")
+	for _, row := range rows {
+		fmt.Printf("    %-16s %9d %10s %10s %10s %10s %9d\n", row.Extension, row.Files,
+			formatBytes(row.Bytes), formatBytes(row.Min), formatBytes(row.Median), formatBytes(row.Max), row.Warnings)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/pkg/xattr"
+)
+
+// Finder flags stored in FinderInfo, from <CarbonCore/Finder.h>
+const (
+	finderFlagColorMask     = 0x000e
+	finderFlagHasBeenInited = 0x0100
+	finderFlagHasCustomIcon = 0x0400
+	finderFlagIsStationery  = 0x0800
+	finderFlagNameLocked    = 0x1000
+	finderFlagHasBundle     = 0x2000
+	finderFlagIsInvisible   = 0x4000
+	finderFlagIsAlias       = 0x8000
+)
+
+const (
+	fixUnhide      = "unhide"
+	fixMakeVisible = "make-visible"
+)
+
+// setFinderFlag sets or clears a flag in a file's FinderInfo, which is at the
+// same offset for files and directories.
+func setFinderFlag(path string, flag uint16, on bool) error {
+	data, err := xattr.Get(path, finderInfoXattr)
+	if err != nil {
+		return err
+	}
+	if len(data) < finderInfoLength {
+		return fmt.Errorf("FinderInfo is too short")
+	}
+	flags := binary.BigEndian.Uint16(data[8:10]) &^ flag
+	if on {
+		flags |= flag
+	}
+	binary.BigEndian.PutUint16(data[8:10], flags)
+	return xattr.Set(path, finderInfoXattr, data)
+}
+
+func isFinderInvisible(path string, info os.FileInfo, attrs []string) bool {
+	if !containsString(attrs, finderInfoXattr) {
+		return false
+	}
+	fi, err := readFinderInfo(path, info.IsDir())
+	return err == nil && fi.flags&finderFlagIsInvisible != 0
+}
+
+// checkInvisible reports items hidden with the FinderInfo invisible bit,
+// which vanish in the Finder but reappear on other platforms. Items hidden
+// with chflags are reported by checkFileFlags.
+func checkInvisible(path string, info os.FileInfo, attrs []string) (logs, warns []string) {
+	if isFinderInvisible(path, info, attrs) {
+		warns = append(warns, "Invisible in the Finder (FinderInfo invisible bit); it exists on disk and will reappear on other platforms.")
+	}
+	return logs, warns
+}
+
+// finderLabel returns the color of the legacy Finder label kept in the
+// FinderInfo flags, or "" if there is none.
+func finderLabel(fi finderInfo) string {
+	return finderTagColors[(fi.flags&finderFlagColorMask)>>1]
+}
+
+// checkColorLabels reports an item's colors, from the legacy Finder label and
+// from its tags, counting each color once per item in counts. It returns the
+// colors, which are often workflow state worth carrying over.
+func checkColorLabels(path string, info os.FileInfo, attrs []string, tagged *taggedFile, counts map[string]int) (logs, warns, colors []string) {
+	if containsString(attrs, finderInfoXattr) {
+		if fi, err := readFinderInfo(path, info.IsDir()); err == nil {
+			if label := finderLabel(fi); label != "" {
+				colors = append(colors, label)
+				logs = append(logs, fmt.Sprintf("Finder label: %s", label))
+			}
+		}
+	}
+	if tagged != nil {
+		for _, tag := range tagged.Tags {
+			if tag.Color != "" && !containsString(colors, tag.Color) {
+				colors = append(colors, tag.Color)
+			}
+		}
+	}
+	for _, color := range colors {
+		counts[color]++
+	}
+	return logs, warns, colors
+}
+
+// checkFinderFlags reports FinderInfo flags that change how the Finder
+// treats a file, and so stop working once the metadata is stripped, counting
+// each in counts.
+func checkFinderFlags(path string, info os.FileInfo, attrs []string, counts map[string]int) (logs, warns []string) {
+	if !containsString(attrs, finderInfoXattr) {
+		return logs, warns
+	}
+	fi, err := readFinderInfo(path, info.IsDir())
+	if err != nil {
+		return logs, warns
+	}
+	if info.Mode().IsRegular() && fi.flags&finderFlagIsStationery != 0 {
+		counts["stationery"]++
+		warns = append(warns, "Stationery pad; opens as a copy in the Finder, but will be edited in place once FinderInfo is stripped.")
+	}
+	if info.Mode().IsRegular() && fi.flags&finderFlagIsAlias != 0 {
+		counts["alias"]++
+		warns = append(warns, "Finder alias (alias bit); it becomes an unusable data file once FinderInfo is stripped.")
+	}
+	if fi.flags&finderFlagHasCustomIcon != 0 {
+		counts["custom icon"]++
+		logs = append(logs, "Custom icon (lost if FinderInfo is stripped)")
+	}
+	if fi.flags&finderFlagNameLocked != 0 {
+		counts["name locked"]++
+		logs = append(logs, "Name locked in the Finder")
+	}
+	if fi.flags&^finderFlagHasBeenInited != 0 && fi.flags&finderFlagHasBeenInited == 0 {
+		counts["not inited"]++
+		logs = append(logs, "FinderInfo flags set without 'has been inited'; the Finder may reset them")
+	}
+	return logs, warns
+}
+
+// checkBundleBit flags files with the bundle bit set, usually old packages
+// saved as flat files, which open incorrectly after a move. Packages are not
+// checked for a missing bit: modern document packages (.pages, .rtfd,
+// .xcodeproj, ...) are recognized by their declared type and never set it.
+// counts tallies each mismatch.
+func checkBundleBit(path string, info os.FileInfo, attrs []string, counts map[string]int) (logs, warns []string) {
+	if !info.Mode().IsRegular() || !containsString(attrs, finderInfoXattr) {
+		return logs, warns
+	}
+	if fi, err := readFinderInfo(path, false); err == nil && fi.flags&finderFlagHasBundle != 0 {
+		counts["file with bundle bit"]++
+		warns = append(warns, "Bundle bit set on a flat file; it may be a package saved as a single file and will open incorrectly.")
+	}
+	return logs, warns
+}
+
+// planUnhides collects items hidden with chflags or the FinderInfo invisible
+// bit under dir.
+func planUnhides(dir string) []fixAction {
+	actions := []fixAction{}
+	err := walkScannable(dir, func(path string, info os.FileInfo) error {
+		if path == dir {
+			return nil
+		}
+		action := fixAction{path: path, size: info.Size(), modTime: info.ModTime()}
+		if fileFlags(info)&ufHidden != 0 {
+			action.kind, action.reason = fixUnhide, "hidden flag"
+			actions = append(actions, action)
+		}
+		if attrs, err := xattr.List(path); err == nil && isFinderInvisible(path, info, attrs) {
+			action.kind, action.reason = fixMakeVisible, "invisible bit"
+			actions = append(actions, action)
+		}
+		return nil
+	})
+	check(err)
+	return actions
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/pkg/xattr"
+)
+
+const finderInfoXattr = "com.apple.FinderInfo"
+
+// finderInfo is the decoded form of the 32-byte com.apple.FinderInfo xattr.
+// Files start with type and creator codes; directories start with a window
+// rectangle, which moves the flags to a different offset.
+type finderInfo struct {
+	fileType string
+	creator  string
+	flags    uint16
+}
+
+func parseFinderInfo(data []byte, isDir bool) (finderInfo, error) {
+	if len(data) < finderInfoLength {
+		return finderInfo{}, errors.New("FinderInfo is too short")
+	}
+	if isDir {
+		return finderInfo{flags: binary.BigEndian.Uint16(data[8:10])}, nil
+	}
+	return finderInfo{
+		fileType: string(data[0:4]),
+		creator:  string(data[4:8]),
+		flags:    binary.BigEndian.Uint16(data[8:10]),
+	}, nil
+}
+
+func readFinderInfo(path string, isDir bool) (finderInfo, error) {
+	data, err := xattr.Get(path, finderInfoXattr)
+	if err != nil {
+		return finderInfo{}, err
+	}
+	return parseFinderInfo(data, isDir)
+}
+
+// hasTypeCode reports whether the type code is set to something meaningful.
+func (fi finderInfo) hasTypeCode() bool {
+	return strings.Trim(fi.fileType, "\x00 ?") != ""
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	firmlinksPath  = "/usr/share/firmlinks"
+	syntheticConf  = "/etc/synthetic.conf"
+	apfsDataVolume = "/System/Volumes/Data"
+)
+
+// firmlinks describes how the APFS volume group joins the read-only system
+// volume and the Data volume: each firmlink makes a Data volume directory
+// appear at a path on the system volume, so a scan of / would reach it twice.
+type firmlinks struct {
+	// system volume paths to the Data volume directories they show
+	sources map[string]string
+	// and the reverse
+	targets map[string]string
+	// root paths created by /etc/synthetic.conf, to their targets if any
+	synthetic map[string]string
+}
+
+// readTabbedLines reads the lines of a tab-separated file, skipping blank
+// lines and comments. A missing file has no lines.
+func readTabbedLines(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := [][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.Split(line, "\t"))
+	}
+	return lines, scanner.Err()
+}
+
+func loadFirmlinks() (*firmlinks, error) {
+	f := &firmlinks{sources: map[string]string{}, targets: map[string]string{}, synthetic: map[string]string{}}
+	lines, err := readTabbedLines(firmlinksPath)
+	if err != nil {
+		return f, err
+	}
+	for _, fields := range lines {
+		if len(fields) != 2 {
+			continue
+		}
+		target := filepath.Join(apfsDataVolume, fields[1])
+		f.sources[fields[0]] = target
+		f.targets[target] = fields[0]
+	}
+	lines, err = readTabbedLines(syntheticConf)
+	for _, fields := range lines {
+		target := ""
+		if len(fields) > 1 {
+			target = fields[len(fields)-1]
+		}
+		f.synthetic["/"+fields[0]] = target
+	}
+	return f, err
+}
+
+func (f *firmlinks) isFirmlink(path string) bool {
+	_, ok := f.sources[path]
+	return ok
+}
+
+// check reports firmlinks and synthetic paths, and whether path should be
+// skipped because the scan reaches it through a firmlink as well.
+func (f *firmlinks) check(path, root string) (logs, warns []string, skip bool) {
+	if target, ok := f.sources[path]; ok {
+		logs = append(logs, fmt.Sprintf("APFS firmlink to '%s' on the Data volume", target))
+	}
+	if source, ok := f.targets[path]; ok && isWithin(source, root) {
+		logs = append(logs, fmt.Sprintf("Skipped: also reached through firmlink '%s', where it is scanned", source))
+		skip = true
+	}
+	if target, ok := f.synthetic[path]; ok {
+		if target != "" {
+			logs = append(logs, fmt.Sprintf("Synthetic path from %s (to '%s')", syntheticConf, target))
+		} else {
+			logs = append(logs, fmt.Sprintf("Synthetic path from %s (mount point)", syntheticConf))
+		}
+	}
+	return logs, warns, skip
+}
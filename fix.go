@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/xattr"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	fixRename     = "rename"
+	fixStripXattr = "strip-xattrs"
+)
+
+// Xattrs kept when stripping "all" because they hold real data or user intent
+var essentialXattrs = []string{
+	"com.apple.FinderInfo",
+	"com.apple.ResourceFork",
+	userTagsXattr,
+}
+
+// fixAction is a single change proposed by the fix command.
+type fixAction struct {
+	kind    string
+	path    string
+	newPath string
+	xattrs  []string
+	reason  string
+	// size and modTime of path when the action was planned
+	size    int64
+	modTime time.Time
+}
+
+// renameRule proposes a new base name for a path, or returns "" to leave it
+// alone. name is the base name proposed so far by earlier rules, while path
+// is still the original on-disk path, for rules that inspect the contents.
+type renameRule func(path, name string, info os.FileInfo) (newName, reason string)
+
+// parseSubstitutions parses "from=to" pairs separated by commas into a
+// replacement map. An empty "to" deletes the character.
+func parseSubstitutions(list string) map[string]string {
+	substitutions := map[string]string{}
+	for _, pair := range splitList(list) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			check(fmt.Errorf("invalid substitution '%s'; expected from=to", pair))
+		}
+		substitutions[parts[0]] = parts[1]
+	}
+	return substitutions
+}
+
+func defaultSubstitutions() string {
+	pairs := []string{}
+	for _, char := range illegalPathnameChars {
+		if char != '/' {
+			pairs = append(pairs, string(char)+"=_")
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func renameIllegalChars(substitutions map[string]string) renameRule {
+	return func(path, base string, info os.FileInfo) (string, string) {
+		name := base
+		for from, to := range substitutions {
+			name = strings.Replace(name, from, to, -1)
+		}
+		if name == base {
+			return "", ""
+		}
+		return name, "illegal characters"
+	}
+}
+
+func trimTrailingChars(path, base string, info os.FileInfo) (string, string) {
+	name := strings.TrimRightFunc(base, func(r rune) bool {
+		for _, illegal := range illegalTrailingChars {
+			if r == illegal {
+				return true
+			}
+		}
+		return false
+	})
+	if name == base {
+		return "", ""
+	}
+	if name == "" {
+		name = "_"
+	}
+	return name, "illegal trailing characters"
+}
+
+func normalizeNames(form norm.Form) renameRule {
+	return func(path, base string, info os.FileInfo) (string, string) {
+		if form.IsNormalString(base) {
+			return "", ""
+		}
+		return form.String(base), "Unicode normalization"
+	}
+}
+
+func parseNormalizationForm(name string) norm.Form {
+	switch strings.ToLower(name) {
+	case "nfc":
+		return norm.NFC
+	case "nfd":
+		return norm.NFD
+	}
+	check(fmt.Errorf("unknown normalization form '%s'; expected nfc or nfd", name))
+	return norm.NFC
+}
+
+// isSameEntry reports whether path names the same file as original, as it
+// does when the filesystem ignores case or normalization differences.
+func isSameEntry(path, original string) bool {
+	a, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	b, err := os.Lstat(original)
+	return err == nil && os.SameFile(a, b)
+}
+
+// uniqueName returns name, or name with a numeric suffix before the extension
+// if it is already taken in dir (on disk or by an earlier proposal). A name
+// that only resolves to original itself is not considered taken; this is what
+// happens when both normalization forms of a name "exist" on APFS or HFS+.
+func uniqueName(dir, name, original string, taken map[string]bool) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; ; i++ {
+		path := filepath.Join(dir, candidate)
+		key := foldCaseNFC(path)
+		_, err := os.Lstat(path)
+		if (os.IsNotExist(err) || isSameEntry(path, original)) && !taken[key] {
+			taken[key] = true
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+}
+
+// proposeRename applies rules in order, each seeing the name produced by the
+// previous one along with the original path, and returns the resulting
+// rename or nil.
+func proposeRename(path string, info os.FileInfo, rules []renameRule, taken map[string]bool) *fixAction {
+	name := filepath.Base(path)
+	reasons := []string{}
+	for _, rule := range rules {
+		newName, reason := rule(path, name, info)
+		if newName != "" && newName != name {
+			name = newName
+			reasons = append(reasons, reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	if unique := uniqueName(filepath.Dir(path), name, path, taken); unique != name {
+		reasons = append(reasons, fmt.Sprintf("'%s' already exists", name))
+		name = unique
+	}
+	return &fixAction{
+		kind:    fixRename,
+		path:    path,
+		newPath: filepath.Join(filepath.Dir(path), name),
+		reason:  strings.Join(reasons, ", "),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+}
+
+// reverseActions orders renames so children are renamed before their
+// parents, keeping earlier paths valid.
+func reverseActions(actions []fixAction) {
+	for i, j := 0, len(actions)-1; i < j; i, j = i+1, j-1 {
+		actions[i], actions[j] = actions[j], actions[i]
+	}
+}
+
+// planRenames walks dir and collects the renames proposed by rules.
+func planRenames(dir string, rules []renameRule) []fixAction {
+	actions := []fixAction{}
+	taken := map[string]bool{}
+	err := walkScannable(dir, func(path string, info os.FileInfo) error {
+		if path == dir {
+			return nil
+		}
+		if action := proposeRename(path, info, rules, taken); action != nil {
+			actions = append(actions, *action)
+		}
+		return nil
+	})
+	check(err)
+	reverseActions(actions)
+	return actions
+}
+
+// planXattrStrips collects the xattrs to remove from each path. names may be
+// "all" to strip everything except essentialXattrs.
+func planXattrStrips(dir string, names []string) []fixAction {
+	actions := []fixAction{}
+	err := walkScannable(dir, func(path string, info os.FileInfo) error {
+		attrs, err := xattr.List(path)
+		if err != nil {
+			fmt.Println(path)
+			log(err.Error(), "error")
+			return nil
+		}
+		strip := []string{}
+		for _, attr := range attrs {
+			if containsString(names, attr) || (containsString(names, "all") && !containsString(essentialXattrs, attr)) {
+				strip = append(strip, attr)
+			}
+		}
+		if len(strip) > 0 {
+			actions = append(actions, fixAction{
+				kind:    fixStripXattr,
+				path:    path,
+				xattrs:  strip,
+				reason:  "selected xattrs",
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	check(err)
+	return actions
+}
+
+// backupXattrs saves the xattrs that strip actions will remove, in the format
+// read by restore-xattrs.
+func backupXattrs(dir string, actions []fixAction, output string) error {
+	manifest := xattrManifest{Root: dir, Files: []xattrManifestEntry{}}
+	for _, action := range actions {
+		if action.kind != fixStripXattr {
+			continue
+		}
+		rel, err := filepath.Rel(dir, action.path)
+		if err != nil {
+			return err
+		}
+		entry := xattrManifestEntry{Path: rel, Xattrs: map[string][]byte{}}
+		for _, name := range action.xattrs {
+			value, err := xattr.Get(action.path, name)
+			if err != nil {
+				return err
+			}
+			entry.Xattrs[name] = value
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
+
+func applyFixAction(action fixAction) error {
+	switch action.kind {
+	case fixUnlock:
+		return setLocked(action.path, false)
+	case fixUnhide:
+		return setFileFlag(action.path, ufHidden, false)
+	case fixMakeVisible:
+		return setFinderFlag(action.path, finderFlagIsInvisible, false)
+	case fixStripXattr:
+		for _, name := range action.xattrs {
+			if err := xattr.Remove(action.path, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case fixRename:
+		if _, err := os.Lstat(action.newPath); err == nil && !isSameEntry(action.newPath, action.path) {
+			return fmt.Errorf("%s already exists", action.newPath)
+		}
+		return os.Rename(action.path, action.newPath)
+	}
+	return fmt.Errorf("unknown fix action '%s'", action.kind)
+}
+
+func describeFixAction(action fixAction) string {
+	switch action.kind {
+	case fixUnlock:
+		return describeUnlock(action)
+	case fixUnhide, fixMakeVisible:
+		return fmt.Sprintf("unhide %s (%s)", action.path, action.reason)
+	case fixStripXattr:
+		return fmt.Sprintf("strip %s from %s", strings.Join(action.xattrs, ", "), action.path)
+	case fixRename:
+		return fmt.Sprintf("rename %s -> %s (%s)", action.path, filepath.Base(action.newPath), action.reason)
+	}
+	return fmt.Sprintf("%s %s (%s)", action.kind, action.path, action.reason)
+}
+
+func fixCommand(args []string) {
+	flags := flag.NewFlagSet("fix", flag.ExitOnError)
+	apply := flags.Bool("apply", false, "Apply the fixes; without this only a dry run is printed")
+	renameIllegal := flags.Bool("renameIllegal", false, "Rename files containing illegal characters")
+	substitutions := flags.String("substitute", defaultSubstitutions(), "Comma-separated from=to character substitutions for -renameIllegal")
+	trimTrailing := flags.Bool("trimTrailing", false, "Strip illegal trailing characters (dots and spaces) from names")
+	addExtensions := flags.Bool("addExtensions", false, "Append extensions inferred from the FinderInfo type code or file contents to files missing one")
+	extensionMap := flags.String("extensionMap", "", "JSON file mapping type codes to extensions for -addExtensions (default: built-in map)")
+	writeExtensionMap := flags.String("writeExtensionMap", "", "Write the built-in type code map to this file for editing, then exit")
+	yes := flags.Bool("yes", false, "Don't ask for confirmation before applying inferred extensions")
+	stripXattrs := flags.String("stripXattrs", "", "Comma-separated xattrs to remove, or 'all' for everything except FinderInfo, resource forks and tags")
+	xattrBackup := flags.String("xattrBackup", "", "Where to back up stripped xattrs for restore-xattrs (default: weirdfs-xattr-backup-<time>.json)")
+	planPath := flags.String("plan", "", "Write proposed fixes to this plan file for review instead of applying them")
+	planFormat := flags.String("planFormat", "", "Plan format: csv or sh (default: from the -plan file extension)")
+	journalPath := flags.String("journal", "", "Undo journal to append applied fixes to (default: weirdfs-undo-<time>.jsonl)")
+	normalize := flags.String("normalize", "", "Rename files to this Unicode normalization form: nfc or nfd")
+	unlock := flags.Bool("unlock", false, "Clear the Finder lock (uchg) flag")
+	unhide := flags.Bool("unhide", false, "Clear the hidden flag and the FinderInfo invisible bit")
+	interactive := flags.Bool("interactive", false, "Step through each proposed fix (renames, unlocks, unhides, and xattr strips) and choose what to do (with no fixes selected, defaults to -renameIllegal -trimTrailing -addExtensions)")
+	flags.Parse(args)
+
+	if *writeExtensionMap != "" {
+		writeTypeCodeExtensions(*writeExtensionMap)
+		return
+	}
+
+	dir := scanRoot(flags.Arg(0))
+	if *interactive && !*renameIllegal && !*trimTrailing && !*addExtensions && *normalize == "" &&
+		*stripXattrs == "" && !*unlock && !*unhide {
+		*renameIllegal, *trimTrailing, *addExtensions = true, true, true
+	}
+	rules := []renameRule{}
+	if *renameIllegal {
+		rules = append(rules, renameIllegalChars(parseSubstitutions(*substitutions)))
+	}
+	if *trimTrailing {
+		rules = append(rules, trimTrailingChars)
+	}
+	if *normalize != "" {
+		rules = append(rules, normalizeNames(parseNormalizationForm(*normalize)))
+	}
+	nameRules := rules
+	if *addExtensions {
+		rules = append(rules, addMissingExtensions(loadTypeCodeExtensions(*extensionMap)))
+	}
+	stripNames := splitList(*stripXattrs)
+	if len(rules) == 0 && len(stripNames) == 0 && !*unlock && !*unhide {
+		fmt.Fprintln(os.Stderr, "fix: no fixes selected")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	actions := []fixAction{}
+	// unlock and strip before renaming so the planned paths are still valid,
+	// and locked files can be renamed
+	if *unlock {
+		actions = append(actions, planUnlocks(dir)...)
+	}
+	if *unhide {
+		actions = append(actions, planUnhides(dir)...)
+	}
+	if len(stripNames) > 0 {
+		actions = append(actions, planXattrStrips(dir, stripNames)...)
+	}
+	if len(rules) > 0 {
+		actions = append(actions, planRenames(dir, rules)...)
+	}
+	if *interactive {
+		if *journalPath == "" {
+			*journalPath = defaultJournalPath()
+		}
+		journal := openUndoJournal(*journalPath)
+		defer journal.close()
+		interactiveFix(actions, journal)
+		return
+	}
+	if *planPath != "" {
+		check(writePlan(actions, *planPath, *planFormat))
+		fmt.Printf("Wrote plan of %d fixes to %s. Nothing was changed.\n", len(actions), *planPath)
+		return
+	}
+	if *apply && *addExtensions && !*yes {
+		actions = confirmExtensionGroups(actions, nameRules)
+	}
+	if *apply && len(stripNames) > 0 {
+		backup := *xattrBackup
+		if backup == "" {
+			backup = fmt.Sprintf("weirdfs-xattr-backup-%s.json", time.Now().Format("20060102-150405"))
+		}
+		check(backupXattrs(dir, actions, backup))
+		fmt.Printf("Backed up stripped xattrs to %s (restore with 'weirdfs restore-xattrs -input %s %s')\n", backup, backup, dir)
+	}
+	failures := 0
+	var journal *undoJournal
+	if *apply && len(actions) > 0 {
+		if *journalPath == "" {
+			*journalPath = defaultJournalPath()
+		}
+		journal = openUndoJournal(*journalPath)
+		defer journal.close()
+	}
+	for _, action := range actions {
+		if !*apply {
+			fmt.Printf("[dry run] %s\n", describeFixAction(action))
+			continue
+		}
+		if err := applyFixActionJournaled(action, journal); err != nil {
+			fmt.Println(action.path)
+			log(err.Error(), "error")
+			failures++
+			continue
+		}
+		fmt.Println(describeFixAction(action))
+	}
+	if *apply {
+		fmt.Printf("\nApplied %d fixes. %d failures.\n", len(actions)-failures, failures)
+	} else {
+		fmt.Printf("\n%d fixes proposed. Dry run only; re-run with -apply to make changes.\n", len(actions))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+)
+
+const hardLinkListLength = 20
+
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkGroup is the paths in the scanned tree sharing one inode. links
+// is the inode's total link count, which includes links outside the tree.
+type hardLinkGroup struct {
+	size  int64
+	links int
+	paths []string
+}
+
+// extraBytes is what a copy tool that doesn't preserve hard links adds by
+// writing each path as an independent file.
+func (g *hardLinkGroup) extraBytes() int64 {
+	return g.size * int64(len(g.paths)-1)
+}
+
+type hardLinks map[inodeKey]*hardLinkGroup
+
+// checkHardLink groups a regular file with the other paths sharing its
+// inode, if it has more than one link.
+func (h hardLinks) checkHardLink(path, displayPath string, info os.FileInfo) (logs, warns []string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || stat.Nlink < 2 {
+		return logs, warns
+	}
+	key := inodeKey{uint64(stat.Dev), stat.Ino}
+	group := h[key]
+	if group == nil {
+		group = &hardLinkGroup{size: info.Size(), links: int(stat.Nlink)}
+		h[key] = group
+	}
+	group.paths = append(group.paths, displayPath)
+	return append(logs, fmt.Sprintf("Hard link (%d links to inode %d)", stat.Nlink, stat.Ino)), warns
+}
+
+// groups returns the groups with more than one path in the tree, largest
+// extra bytes first.
+func (h hardLinks) groups() []*hardLinkGroup {
+	groups := []*hardLinkGroup{}
+	for _, group := range h {
+		if len(group.paths) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].extraBytes() > groups[j].extraBytes() })
+	return groups
+}
+
+func (h hardLinks) print() {
+	groups := h.groups()
+	var extra int64
+	paths := 0
+	for _, group := range groups {
+		extra += group.extraBytes()
+		paths += len(group.paths)
+	}
+	outside := 0
+	for _, group := range h {
+		if group.links > len(group.paths) {
+			outside++
+		}
+	}
+	fmt.Printf("\nHard links: %d files with more than one link; %d groups of %d paths within the tree", len(h), len(groups), paths)
+	if outside > 0 {
+		fmt.Printf(", %d files also linked from outside it", outside)
+	}
+	fmt.Printf(".\nCopying without preserving hard links (e.g. rsync without -H) adds %s.\n", formatBytes(extra))
+	if len(groups) > hardLinkListLength {
+		groups = groups[:hardLinkListLength]
+	}
+	for _, group := range groups {
+		fmt.Printf("    %s x %d (+%s)\n", formatBytes(group.size), len(group.paths), formatBytes(group.extraBytes()))
+		for _, path := range group.paths {
+			fmt.Printf("        %s\n", path)
+		}
+	}
+}
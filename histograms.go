@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const histogramWidth = 40
+
+// histogramBar draws count as a bar scaled so that max fills the width.
+func histogramBar(count, max int) string {
+	if max == 0 {
+		return ""
+	}
+	n := count * histogramWidth / max
+	if n == 0 && count > 0 {
+		n = 1
+	}
+	return strings.Repeat("#", n)
+}
+
+// yearCounts counts files by the year of their modification and creation
+// times.
+type yearCounts struct {
+	modified map[int]int
+	created  map[int]int
+}
+
+func newYearCounts() *yearCounts {
+	return &yearCounts{modified: map[int]int{}, created: map[int]int{}}
+}
+
+func (c *yearCounts) add(modified, created time.Time) {
+	c.modified[modified.Year()]++
+	if !created.IsZero() {
+		c.created[created.Year()]++
+	}
+}
+
+// years returns every year with a count, oldest first.
+func (c *yearCounts) years() []int {
+	seen := map[int]bool{}
+	for year := range c.modified {
+		seen[year] = true
+	}
+	for year := range c.created {
+		seen[year] = true
+	}
+	years := make([]int, 0, len(seen))
+	for year := range seen {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	return years
+}
+
+// ageHistogram characterizes the vintage of a tree: how many files were
+// modified and created in each year, overall and per extension. A spike in
+// one year often marks an old copy that reset the times.
+type ageHistogram struct {
+	overall     *yearCounts
+	byExtension map[string]*yearCounts
+}
+
+func newAgeHistogram() *ageHistogram {
+	return &ageHistogram{overall: newYearCounts(), byExtension: map[string]*yearCounts{}}
+}
+
+func (h *ageHistogram) add(path string, info os.FileInfo) {
+	var created time.Time
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		created = time.Unix(stat.Birthtimespec.Sec, stat.Birthtimespec.Nsec)
+	}
+	h.overall.add(info.ModTime(), created)
+	ext := extensionLabel(path)
+	if h.byExtension[ext] == nil {
+		h.byExtension[ext] = newYearCounts()
+	}
+	h.byExtension[ext].add(info.ModTime(), created)
+}
+
+// formatYearCounts lists counts as "year:count", oldest first.
+func formatYearCounts(counts map[int]int, years []int) string {
+	fields := []string{}
+	for _, year := range years {
+		if counts[year] > 0 {
+			fields = append(fields, fmt.Sprintf("%d:%d", year, counts[year]))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func (h *ageHistogram) print() {
+	years := h.overall.years()
+	max := 0
+	for _, year := range years {
+		if h.overall.modified[year] > max {
+			max = h.overall.modified[year]
+		}
+		if h.overall.created[year] > max {
+			max = h.overall.created[year]
+		}
+	}
+	fmt.Println("\nFiles by year (modified, created):")
+	for _, year := range years {
+		fmt.Printf("    %d  %8d %-*s %8d %s\n", year, h.overall.modified[year], histogramWidth, histogramBar(h.overall.modified[year], max),
+			h.overall.created[year], histogramBar(h.overall.created[year], max))
+	}
+	fmt.Println("    By extension:")
+	for _, ext := range sortedYearCountKeys(h.byExtension) {
+		counts := h.byExtension[ext]
+		years := counts.years()
+		fmt.Printf("        %s modified: %s\n", ext, formatYearCounts(counts.modified, years))
+		fmt.Printf("        %s created: %s\n", ext, formatYearCounts(counts.created, years))
+	}
+}
+
+func sortedYearCountKeys(m map[string]*yearCounts) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Upper bounds of the size histogram's buckets. 4GB is the FAT32 file size
+// limit, and beyond 50GB most sync clients and web uploads give up.
+var sizeBuckets = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20, 1 << 30, 4 << 30, 50 << 30}
+
+var sizePercentiles = []int{10, 25, 50, 75, 90, 99}
+
+// percentile returns the pth percentile of sorted sizes.
+func percentile(sorted []int64, p int) int64 {
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func formatPercentiles(sorted []int64) string {
+	fields := []string{}
+	for _, p := range sizePercentiles {
+		fields = append(fields, fmt.Sprintf("p%d %s", p, formatBytes(percentile(sorted, p))))
+	}
+	return strings.Join(append(fields, "max "+formatBytes(sorted[len(sorted)-1])), ", ")
+}
+
+// printSizeDistribution prints a histogram and percentiles of file sizes,
+// overall and per extension, and counts the sizes sync tools handle badly.
+func printSizeDistribution(stats extensionStats) {
+	all := []int64{}
+	for _, stat := range stats {
+		sort.Slice(stat.sizes, func(i, j int) bool { return stat.sizes[i] < stat.sizes[j] })
+		all = append(all, stat.sizes...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	counts := make([]int, len(sizeBuckets)+1)
+	zero, over4GB, over50GB := 0, 0, 0
+	for _, size := range all {
+		bucket := sort.Search(len(sizeBuckets), func(i int) bool { return size < sizeBuckets[i] })
+		counts[bucket]++
+		switch {
+		case size == 0:
+			zero++
+		case size > 50<<30:
+			over50GB++
+			over4GB++
+		case size > 4<<30:
+			over4GB++
+		}
+	}
+	max := 0
+	for _, count := range counts {
+		if count > max {
+			max = count
+		}
+	}
+	fmt.Println("\nFile sizes:")
+	for i, count := range counts {
+		label := "over " + formatBytes(sizeBuckets[len(sizeBuckets)-1])
+		if i < len(sizeBuckets) {
+			label = "under " + formatBytes(sizeBuckets[i])
+		}
+		fmt.Printf("    %-15s %9d %s\n", label, count, histogramBar(count, max))
+	}
+	fmt.Printf("    Percentiles: %s\n", formatPercentiles(all))
+	fmt.Printf("    Zero-byte: %d; over 4GB (too large for FAT32): %d; over 50GB (too large for most sync clients): %d\n", zero, over4GB, over50GB)
+	fmt.Println("    By extension:")
+	exts := make([]string, 0, len(stats))
+	for ext := range stats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		fmt.Printf("        %s: %s\n", ext, formatPercentiles(stats[ext].sizes))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isICloudPlaceholder matches the ".name.icloud" files iCloud Drive leaves in
+// place of evicted files on older versions of macOS.
+func isICloudPlaceholder(path string, info os.FileInfo) bool {
+	base := filepath.Base(path)
+	return info.Mode().IsRegular() && strings.HasPrefix(base, ".") && strings.HasSuffix(base, ".icloud") && len(base) > len("..icloud")
+}
+
+// checkICloudPlaceholder reports the original name and size recorded in an
+// iCloud placeholder plist, falling back to the name in the placeholder's
+// own name.
+func checkICloudPlaceholder(path string, tally *fileTally) (logs, warns []string) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "."), ".icloud")
+	var size int64
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		var plist interface{}
+		plist, err = parseBinaryPlist(data)
+		if dict, ok := plist.(map[string]interface{}); ok {
+			if original, ok := dict["NSURLNameKey"].(string); ok {
+				name = original
+			}
+			if n, ok := dict["NSURLFileSizeKey"].(int64); ok {
+				size = n
+			}
+		}
+	}
+	if err != nil {
+		warns = append(warns, fmt.Sprintf("Error reading iCloud placeholder: %s", err))
+	}
+	tally.add(size)
+	return logs, append(warns, fmt.Sprintf("iCloud Drive placeholder for '%s' (%s); download it before archiving or copying the tree.", name, formatBytes(size)))
+}
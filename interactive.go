@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/xattr"
+)
+
+const (
+	interactiveRenamePrompt = "[r]ename as suggested, [e]dit name, [s]kip, skip [a]ll of this rule, [x] strip xattrs, [o]pen in Finder, [q]uit? "
+	interactiveFixPrompt    = "[y] apply as suggested, [s]kip, skip [a]ll of this rule, [x] strip xattrs, [o]pen in Finder, [q]uit? "
+)
+
+// ruleKey identifies the rule behind a fix reason for "skip all", ignoring
+// per-file details in parentheses.
+func ruleKey(reason string) string {
+	if i := strings.Index(reason, " ("); i > -1 {
+		return reason[:i]
+	}
+	return reason
+}
+
+func prompt(in *bufio.Reader, msg string) string {
+	fmt.Print(msg)
+	answer, err := in.ReadString('\n')
+	if err != nil {
+		return "q"
+	}
+	return strings.TrimSpace(answer)
+}
+
+// promptStripXattrs asks which xattrs to remove from path.
+func promptStripXattrs(in *bufio.Reader, path string, journal *undoJournal) {
+	attrs, err := xattr.List(path)
+	if err != nil || len(attrs) == 0 {
+		fmt.Println("    No xattrs.")
+		return
+	}
+	fmt.Printf("    xattrs: %s\n", strings.Join(attrs, ", "))
+	answer := prompt(in, "    Strip which (comma-separated, 'all', or blank for none)? ")
+	names := splitList(answer)
+	if answer == "all" {
+		names = attrs
+	}
+	if len(names) == 0 {
+		return
+	}
+	action := fixAction{kind: fixStripXattr, path: path, xattrs: names, reason: "interactive"}
+	if err := applyFixActionJournaled(action, journal); err != nil {
+		log(err.Error(), "error")
+		return
+	}
+	fmt.Printf("    %s\n", describeFixAction(action))
+}
+
+// interactiveFix steps through the planned fixes of every kind, letting the
+// user decide what to do with each one.
+func interactiveFix(actions []fixAction, journal *undoJournal) {
+	in := bufio.NewReader(os.Stdin)
+	skippedRules := map[string]bool{}
+	applied := 0
+
+	for _, action := range actions {
+		key := action.kind + ": " + ruleKey(action.reason)
+		if skippedRules[key] {
+			continue
+		}
+		info, err := os.Lstat(action.path)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("\n%s\n", action.path)
+		_, warns := checkBasename(action.path, info, false)
+		logMany(warns, "warn")
+		msg := interactiveFixPrompt
+		if action.kind == fixRename {
+			msg = interactiveRenamePrompt
+			fmt.Printf("    Suggested: %s (%s)\n", filepath.Base(action.newPath), action.reason)
+		} else {
+			fmt.Printf("    Suggested: %s\n", describeFixAction(action))
+		}
+
+	ask:
+		for {
+			answer := prompt(in, msg)
+			if answer == "y" && action.kind != fixRename {
+				answer = "r"
+			}
+			switch answer {
+			case "r":
+				if err := applyFixActionJournaled(action, journal); err != nil {
+					log(err.Error(), "error")
+					continue
+				}
+				applied++
+				break ask
+			case "e":
+				if action.kind != fixRename {
+					continue
+				}
+				name := prompt(in, "    New name: ")
+				if name == "" || strings.ContainsRune(name, '/') {
+					fmt.Println("    Invalid name.")
+					continue
+				}
+				edited := action
+				edited.newPath = filepath.Join(filepath.Dir(action.path), name)
+				edited.reason = "edited by hand"
+				if err := applyFixActionJournaled(edited, journal); err != nil {
+					log(err.Error(), "error")
+					continue
+				}
+				applied++
+				break ask
+			case "s", "":
+				break ask
+			case "a":
+				skippedRules[key] = true
+				break ask
+			case "x":
+				promptStripXattrs(in, action.path, journal)
+			case "o":
+				if err := exec.Command("open", "-R", action.path).Run(); err != nil {
+					log(err.Error(), "error")
+				}
+			case "q":
+				fmt.Printf("\nApplied %d fixes.\n", applied)
+				return
+			}
+		}
+	}
+	fmt.Printf("\nApplied %d fixes.\n", applied)
+}
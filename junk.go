@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// junkCategory describes a family of files or directories that are safe to
+// remove before a transfer. Patterns are matched against base names with
+// filepath.Match.
+type junkCategory struct {
+	name        string
+	description string
+	dirs        []string
+	files       []string
+	ignoreCase  bool
+	// inspect optionally describes a matched directory in more detail
+	inspect func(path string) (logs, warns []string)
+}
+
+var junkCategories = []*junkCategory{
+	{
+		name:        "nas",
+		description: "Synology/QNAP NAS artifact",
+		dirs:        []string{"@eaDir", "#recycle", "#snapshot", "@Recycle", "@Recently-Snapshot", "@sharebin", "@tmp", ".@__thumb", ".@__qini", ".@__desc", ".streams"},
+		files:       []string{".@__thumb*"},
+	},
+	{
+		name:        "windows",
+		description: "Windows client junk",
+		dirs:        []string{"$recycle.bin", "recycler", "system volume information"},
+		files:       []string{"thumbs.db", "ehthumbs.db", "ehthumbs_vista.db", "desktop.ini"},
+		ignoreCase:  true,
+	},
+	{
+		name:        "build",
+		description: "Regenerable build artifact or dependency directory",
+		dirs:        defaultBuildArtifactDirs,
+	},
+	{
+		name:        "temp",
+		description: "Temporary or lock file left by interrupted work",
+		files:       []string{"~$*", "*.swp", "*.swo", "*~", ".#*", "*.tmp", "*.temp", "*.partial", "*.part", "*.crdownload"},
+		ignoreCase:  true,
+	},
+	{
+		name:        "macosx",
+		description: "__MACOSX folder left by unzipping an archive",
+		dirs:        []string{macOSXDir},
+		inspect:     inspectMacOSXDir,
+	},
+}
+
+var defaultBuildArtifactDirs = []string{
+	"node_modules",
+	"bower_components",
+	"Pods",
+	"Carthage",
+	"DerivedData",
+	".venv",
+	"venv",
+	"__pycache__",
+	".tox",
+	".mypy_cache",
+	".pytest_cache",
+	".gradle",
+	".next",
+	".bundle",
+	"target",
+}
+
+// Build directory names common enough to be user folders, which only count
+// as build output beside the project file that produces them.
+var buildArtifactMarkers = map[string][]string{
+	"target":   {"pom.xml", "Cargo.toml", "build.sbt", "go.mod"},
+	"Carthage": {"Cartfile", "Cartfile.resolved", "Package.swift"},
+	".bundle":  {"Gemfile"},
+}
+
+// hasBuildMarker reports whether a directory with a name that needs a marker
+// has one of its project files beside it.
+func hasBuildMarker(path string) bool {
+	markers, ok := buildArtifactMarkers[filepath.Base(path)]
+	if !ok {
+		return true
+	}
+	for _, marker := range markers {
+		if _, err := os.Lstat(filepath.Join(filepath.Dir(path), marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// setJunkPatterns replaces the directory patterns of a junk category with a
+// comma-separated list.
+func setJunkPatterns(name, list string) {
+	findJunkCategory(name).dirs = splitList(list)
+}
+
+// addJunkFilePatterns extends the file patterns of a junk category with a
+// comma-separated list.
+func addJunkFilePatterns(name, list string) {
+	category := findJunkCategory(name)
+	for _, pattern := range splitList(list) {
+		if category.ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		category.files = append(category.files, pattern)
+	}
+}
+
+func findJunkCategory(name string) *junkCategory {
+	for _, category := range junkCategories {
+		if category.name == name {
+			return category
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, basename string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, basename); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchJunk returns the junk category a path belongs to, if any.
+func matchJunk(path string, info os.FileInfo) *junkCategory {
+	basename := filepath.Base(path)
+	for _, category := range junkCategories {
+		patterns := category.files
+		if info.IsDir() {
+			patterns = category.dirs
+		}
+		name := basename
+		if category.ignoreCase {
+			name = strings.ToLower(basename)
+		}
+		if matchesAny(patterns, name) {
+			if category.name == "build" && info.IsDir() && !hasBuildMarker(path) {
+				return nil
+			}
+			return category
+		}
+	}
+	return nil
+}
+
+// parseJunkCategories parses a comma-separated list of junk category names.
+func parseJunkCategories(list string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		if findJunkCategory(name) == nil {
+			check(fmt.Errorf("unknown junk category '%s'", name))
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func junkCategoryNames() string {
+	names := make([]string, len(junkCategories))
+	for i, category := range junkCategories {
+		names[i] = category.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkJunk tallies a junk file or directory, returning the size it occupies.
+func checkJunk(path string, info os.FileInfo, category *junkCategory) (logs, warns []string, size int64) {
+	if !info.IsDir() {
+		return logs, append(warns, fmt.Sprintf("%s (%s).", category.description, formatBytes(info.Size()))), info.Size()
+	}
+	size, files := dirSize(path)
+	warns = append(warns, fmt.Sprintf("%s (%d files, %s).", category.description, files, formatBytes(size)))
+	if category.inspect != nil {
+		logs2, warns2 := category.inspect(path)
+		logs = append(logs, logs2...)
+		warns = append(warns, warns2...)
+	}
+	return logs, warns, size
+}
+
+// removeJunk moves a junk file or directory to the quarantine area.
+func removeJunk(path string, category *junkCategory, undo *undoContext) (logs, warns []string) {
+	if err := undo.remove(path); err != nil {
+		return logs, append(warns, fmt.Sprintf("Error removing junk: %s", err))
+	}
+	return append(logs, fmt.Sprintf("Moved %s to %s", category.description, quarantineDirName)), warns
+}
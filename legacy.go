@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Legacy Mac archive formats by extension. Most modern tools can't extract
+// them, and their contents usually include resource forks.
+var legacyArchiveExtensions = map[string]string{
+	".sit":  "StuffIt",
+	".sitx": "StuffIt X",
+	".hqx":  "BinHex",
+	".cpt":  "Compact Pro",
+	".sea":  "self-extracting archive",
+}
+
+// ...and by FinderInfo type code
+var legacyArchiveTypeCodes = map[string]string{
+	"SIT!": "StuffIt",
+	"SITD": "StuffIt",
+	"SIT5": "StuffIt",
+	"SITX": "StuffIt X",
+	"PACT": "Compact Pro",
+}
+
+// legacyArchiveKind identifies a legacy archive by its extension or type
+// code, or by its content if it has no extension.
+func legacyArchiveKind(path string) string {
+	ext := strictFileExtension(path)
+	if name, ok := legacyArchiveExtensions[ext]; ok {
+		return name
+	}
+	if fi, err := readFinderInfo(path, false); err == nil && fi.hasTypeCode() {
+		if name, ok := legacyArchiveTypeCodes[fi.fileType]; ok {
+			return name
+		}
+	}
+	if ext == "" {
+		if magicExt, name := sniffExtension(path); legacyArchiveExtensions[magicExt] != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func checkLegacyArchive(path string, info os.FileInfo) (logs, warns []string, kind string) {
+	if !info.Mode().IsRegular() {
+		return logs, warns, ""
+	}
+	kind = legacyArchiveKind(path)
+	if kind != "" {
+		warns = append(warns, fmt.Sprintf("Legacy Mac archive (%s); contents likely include resource forks and can't be extracted by most modern tools.", kind))
+	}
+	return logs, warns, kind
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Application libraries are directories their applications manage as a
+// database; copying them piecemeal, or syncing them while open, corrupts them.
+var appLibraryExtensions = map[string]string{
+	".photoslibrary":        "Photos library",
+	".migratedphotolibrary": "Photos library",
+	".photolibrary":         "iPhoto library",
+	".aplibrary":            "Aperture library",
+	".imovielibrary":        "iMovie library",
+	".theater":              "iMovie theater",
+	".fcpbundle":            "Final Cut Pro library",
+	".musiclibrary":         "Music library",
+	".tvlibrary":            "TV library",
+	".lrdata":               "Lightroom previews",
+	".mbox":                 "Mail mailbox",
+	".mailbundle":           "Mail bundle",
+	".logicx":               "Logic Pro project",
+	".band":                 "GarageBand project",
+}
+
+var appLibraryNames = map[string]string{
+	"Outlook 15 Profiles": "Outlook profile",
+	"Microsoft User Data": "Office identity",
+}
+
+func appLibraryKind(path string, info os.FileInfo) string {
+	if !info.IsDir() {
+		return ""
+	}
+	if kind := appLibraryNames[filepath.Base(path)]; kind != "" {
+		return kind
+	}
+	return appLibraryExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// checkAppLibrary reports an application library as one object.
+func checkAppLibrary(path, kind string) (logs, warns []string, size int64) {
+	size, files := dirSize(path)
+	logs = append(logs, fmt.Sprintf("%d files, %s", files, formatBytes(size)))
+	warns = append(warns, fmt.Sprintf("Application library (%s); copy it only as a whole with the application closed, since syncing or partially copying it corrupts the library.", kind))
+	return logs, warns, size
+}
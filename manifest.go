@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+const defaultManifest = "weirdfs-manifest.json"
+
+// fileManifest records the fixity information for a tree. A sha256sum-style
+// digest of the manifest itself is written alongside it so the manifest can
+// be signed or checked independently.
+type fileManifest struct {
+	Root    string          `json:"root"`
+	Created time.Time       `json:"created"`
+	Files   []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Path               string    `json:"path"`
+	Dir                bool      `json:"dir,omitempty"`
+	Size               int64     `json:"size"`
+	SHA256             string    `json:"sha256,omitempty"`
+	ModTime            time.Time `json:"mtime"`
+	Xattrs             []string  `json:"xattrs,omitempty"`
+	ResourceForkSHA256 string    `json:"resourceForkSha256,omitempty"`
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildManifestEntry collects the fixity information for one path.
+func buildManifestEntry(root, path string, info os.FileInfo) (manifestEntry, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	entry := manifestEntry{Path: rel, Dir: info.IsDir(), ModTime: info.ModTime()}
+	if info.Mode().IsRegular() {
+		entry.Size = info.Size()
+		if entry.SHA256, err = hashFile(path); err != nil {
+			return entry, err
+		}
+	}
+	names, err := xattr.List(path)
+	if err != nil {
+		return entry, err
+	}
+	entry.Xattrs = removeIgnoredXattrs(names)
+	sort.Strings(entry.Xattrs)
+	if containsString(entry.Xattrs, "com.apple.ResourceFork") {
+		rsrc, err := xattr.Get(path, "com.apple.ResourceFork")
+		if err != nil {
+			return entry, err
+		}
+		entry.ResourceForkSHA256 = hashBytes(rsrc)
+	}
+	return entry, nil
+}
+
+func readManifest(path string) fileManifest {
+	data, err := ioutil.ReadFile(path)
+	check(err)
+	var manifest fileManifest
+	check(json.Unmarshal(data, &manifest))
+	return manifest
+}
+
+func manifestCommand(args []string) {
+	flags := flag.NewFlagSet("manifest", flag.ExitOnError)
+	output := flags.String("output", defaultManifest, "Path of the manifest to write")
+	flags.Parse(args)
+
+	dir := scanRoot(flags.Arg(0))
+	manifest := fileManifest{Root: dir, Created: time.Now().UTC(), Files: []manifestEntry{}}
+	outputPath, err := filepath.Abs(*output)
+	check(err)
+	var totalSize int64
+
+	err = walkScannable(dir, func(path string, info os.FileInfo) error {
+		if path == outputPath || path == outputPath+".sha256" {
+			return nil
+		}
+		printStatusLine(fmt.Sprintf("%d: %s", len(manifest.Files), path))
+		entry, err := buildManifestEntry(dir, path, info)
+		if err != nil {
+			printStatusLine("")
+			fmt.Println(path)
+			log(err.Error(), "error")
+		}
+		manifest.Files = append(manifest.Files, entry)
+		totalSize += entry.Size
+		return nil
+	})
+	check(err)
+	printStatusLine("")
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	check(err)
+	check(ioutil.WriteFile(*output, data, 0644))
+	digest := fmt.Sprintf("%s  %s\n", hashBytes(data), filepath.Base(*output))
+	check(ioutil.WriteFile(*output+".sha256", []byte(digest), 0644))
+	fmt.Printf("Wrote manifest of %d entries (%s) to %s\n", len(manifest.Files), formatBytes(totalSize), *output)
+}
+
+// manifestDifferences describes how a path differs from its manifest entry.
+func manifestDifferences(expected, actual manifestEntry) []string {
+	diffs := []string{}
+	if expected.Dir != actual.Dir {
+		diffs = append(diffs, "Changed type (file vs. directory).")
+		return diffs
+	}
+	if expected.SHA256 != actual.SHA256 || expected.Size != actual.Size {
+		diffs = append(diffs, fmt.Sprintf("Content changed (%s -> %s).", formatBytes(expected.Size), formatBytes(actual.Size)))
+	}
+	if !expected.ModTime.Equal(actual.ModTime) {
+		diffs = append(diffs, fmt.Sprintf("Modification time changed (%v -> %v).", expected.ModTime, actual.ModTime))
+	}
+	for _, name := range expected.Xattrs {
+		if !containsString(actual.Xattrs, name) {
+			diffs = append(diffs, fmt.Sprintf("Lost xattr %s.", name))
+		}
+	}
+	if expected.ResourceForkSHA256 != "" && actual.ResourceForkSHA256 != "" && expected.ResourceForkSHA256 != actual.ResourceForkSHA256 {
+		diffs = append(diffs, "Resource fork changed.")
+	}
+	return diffs
+}
+
+func verifyManifestCommand(args []string) {
+	flags := flag.NewFlagSet("verify-manifest", flag.ExitOnError)
+	root := flags.String("root", "", "Tree to verify (default: the root recorded in the manifest)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs verify-manifest [-root dir] <manifest>")
+		os.Exit(2)
+	}
+
+	manifest := readManifest(flags.Arg(0))
+	dir := manifest.Root
+	if *root != "" {
+		dir = scanRoot(*root)
+	}
+	fmt.Printf("Verifying %s against manifest from %v\n", dir, manifest.Created)
+
+	expected := map[string]bool{}
+	missing, changed, unreadable, ok := 0, 0, 0, 0
+	for i, entry := range manifest.Files {
+		expected[entry.Path] = true
+		path := filepath.Join(dir, entry.Path)
+		printStatusLine(fmt.Sprintf("%d: %s", i, path))
+		info, err := os.Lstat(path)
+		if err != nil {
+			missing++
+			printStatusLine("")
+			fmt.Println(path)
+			log("Missing.", "error")
+			continue
+		}
+		actual, err := buildManifestEntry(dir, path, info)
+		if err != nil {
+			unreadable++
+			printStatusLine("")
+			fmt.Println(path)
+			log(err.Error(), "error")
+			continue
+		}
+		if diffs := manifestDifferences(entry, actual); len(diffs) > 0 {
+			changed++
+			printStatusLine("")
+			fmt.Println(path)
+			logMany(diffs, "warn")
+			continue
+		}
+		ok++
+	}
+
+	added := 0
+	err := walkScannable(dir, func(path string, info os.FileInfo) error {
+		rel, err := filepath.Rel(dir, path)
+		check(err)
+		if rel != "." && !expected[rel] {
+			added++
+			printStatusLine("")
+			fmt.Println(path)
+			log("Not in manifest.", "info")
+		}
+		return nil
+	})
+	check(err)
+	printStatusLine("")
+
+	fmt.Printf("\nFixity summary: %d entries in manifest; %d verified, %d changed, %d missing, %d unreadable, %d not in manifest.\n",
+		len(manifest.Files), ok, changed, missing, unreadable, added)
+	// a file that couldn't be read wasn't verified either
+	if changed > 0 || missing > 0 || unreadable > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkMergeCollisions reports source entries that would overwrite, or
+// collide by case or normalization with, entries already in dest.
+func checkMergeCollisions(source, dest string) fidelityReport {
+	report := fidelityReport{}
+	resolver := newDestResolver(dest, foldCaseNFC)
+	checked := 0
+
+	err := walkScannable(source, func(path string, info os.FileInfo) error {
+		rel, err := filepath.Rel(source, path)
+		check(err)
+		if rel == "." {
+			return nil
+		}
+		checked++
+		printStatusLine(fmt.Sprintf("%d: %s", checked, path))
+
+		destPath, folded, err := resolver.resolve(rel)
+		if err != nil {
+			return nil
+		}
+		destInfo, err := os.Lstat(destPath)
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() != destInfo.IsDir() {
+			report.add("type conflicts", path, fmt.Sprintf("Conflicts with %s (file vs. directory).", destPath), "error")
+			return nil
+		}
+		if folded {
+			report.add("name collisions", path, fmt.Sprintf("Collides by case or normalization with %s.", destPath), "warn")
+		}
+		if info.IsDir() {
+			return nil
+		}
+		identical := false
+		if info.Size() == destInfo.Size() {
+			if identical, err = sameContents(path, destPath); err != nil {
+				report.add("errors", path, err.Error(), "error")
+				return nil
+			}
+		}
+		if identical {
+			report.add("identical", path, fmt.Sprintf("Already present at %s with identical contents.", destPath), "info")
+		} else {
+			report.add("overwrites", path, fmt.Sprintf("Would overwrite %s (%s vs. %s, modified %v vs. %v).",
+				destPath, formatBytes(info.Size()), formatBytes(destInfo.Size()), info.ModTime(), destInfo.ModTime()), "warn")
+		}
+		return nil
+	})
+	check(err)
+	printStatusLine("")
+	fmt.Printf("\nChecked %d source entries.\n", checked)
+	return report
+}
+
+func mergeCheckCommand(args []string) {
+	flags := flag.NewFlagSet("merge-check", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs merge-check <source> <dest>")
+		os.Exit(2)
+	}
+	source := scanRoot(flags.Arg(0))
+	dest := scanRoot(flags.Arg(1))
+	fmt.Printf("Checking merge of %s into %s\n", source, dest)
+
+	report := checkMergeCollisions(source, dest)
+	printFidelityReport(report)
+}
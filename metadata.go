@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+const finderCommentXattr = "com.apple.metadata:kMDItemFinderComment"
+const whereFromsXattr = "com.apple.metadata:kMDItemWhereFroms"
+const quarantineXattr = "com.apple.quarantine"
+
+// quarantineInfo is the decoded form of com.apple.quarantine, which is stored
+// as "flags;hex timestamp;agent;UUID".
+type quarantineInfo struct {
+	flags     string
+	timestamp time.Time
+	agent     string
+	uuid      string
+}
+
+// pathValue pairs a file with a decoded metadata value for export.
+type pathValue struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// readMetadataStrings decodes a com.apple.metadata xattr, which is normally a
+// binary plist holding a string or array of strings. Some older tools wrote
+// plain UTF-8 instead.
+func readMetadataStrings(path, name string) ([]string, error) {
+	raw, err := xattr.Get(path, name)
+	if err != nil {
+		return nil, err
+	}
+	if !isBinaryPlist(raw) {
+		return []string{strings.TrimRight(string(raw), "\x00")}, nil
+	}
+	value, err := parseBinaryPlist(raw)
+	if err != nil {
+		return nil, err
+	}
+	return plistStrings(value), nil
+}
+
+func checkFinderComment(path string, attrs []string) (logs, warns []string, comment string) {
+	if !containsString(attrs, finderCommentXattr) {
+		return logs, warns, ""
+	}
+	values, err := readMetadataStrings(path, finderCommentXattr)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error decoding Finder comment: %s", err)), ""
+	}
+	comment = strings.Join(values, "\n")
+	if comment != "" {
+		logs = append(logs, fmt.Sprintf("Finder comment: %q", comment))
+	}
+	return logs, warns, comment
+}
+
+// checkWhereFroms decodes the download URLs and senders recorded for a file.
+func checkWhereFroms(path string, attrs []string) (logs, warns, sources []string) {
+	if !containsString(attrs, whereFromsXattr) {
+		return logs, warns, nil
+	}
+	values, err := readMetadataStrings(path, whereFromsXattr)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error decoding kMDItemWhereFroms: %s", err)), nil
+	}
+	for _, value := range values {
+		if value != "" {
+			sources = append(sources, value)
+		}
+	}
+	if len(sources) > 0 {
+		logs = append(logs, fmt.Sprintf("Where from: %s", strings.Join(sources, ", ")))
+	}
+	return logs, warns, sources
+}
+
+func parseQuarantine(raw string) quarantineInfo {
+	parts := strings.SplitN(strings.TrimRight(raw, "\x00"), ";", 4)
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	info := quarantineInfo{flags: parts[0], agent: parts[2], uuid: parts[3]}
+	if seconds, err := strconv.ParseInt(parts[1], 16, 64); err == nil {
+		info.timestamp = time.Unix(seconds, 0)
+	}
+	if info.agent == "" {
+		info.agent = "(unknown agent)"
+	}
+	return info
+}
+
+// checkQuarantine decodes a file's quarantine attribute, optionally removing it.
+func checkQuarantine(path string, attrs []string, undo *undoContext) (logs, warns []string, quarantine *quarantineInfo) {
+	if !containsString(attrs, quarantineXattr) {
+		return logs, warns, nil
+	}
+	raw, err := xattr.Get(path, quarantineXattr)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err)), nil
+	}
+	info := parseQuarantine(string(raw))
+	logs = append(logs, fmt.Sprintf("Quarantined by %s at %v (flags %s, UUID %s)", info.agent, info.timestamp, info.flags, info.uuid))
+	if undo != nil {
+		if err := undo.removeXattr(path, quarantineXattr); err != nil {
+			return logs, append(warns, fmt.Sprintf("Error clearing quarantine: %s", err)), &info
+		}
+		logs = append(logs, "Cleared quarantine attribute")
+	}
+	return logs, warns, &info
+}
+
+func exportPathValues(values []pathValue, output, format, name string) error {
+	rows := make([][]string, len(values))
+	for i, v := range values {
+		rows[i] = []string{v.Path, v.Value}
+	}
+	return exportRecords(output, format, values, []string{"path", name}, rows)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// metadataRisk totals the resource fork and non-ignored xattr bytes in the
+// tree: what a naive copy to a non-Mac filesystem would silently lose.
+type metadataRisk struct {
+	files       int
+	size        int64
+	byExtension map[string]*fileTally
+}
+
+func newMetadataRisk() *metadataRisk {
+	return &metadataRisk{byExtension: map[string]*fileTally{}}
+}
+
+// add counts the xattr sizes of one file or directory, as returned by
+// checkXattrSizes.
+func (r *metadataRisk) add(path string, sizes map[string]int64) {
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	if total == 0 {
+		return
+	}
+	r.files++
+	r.size += total
+	ext := extensionLabel(path)
+	if r.byExtension[ext] == nil {
+		r.byExtension[ext] = &fileTally{}
+	}
+	r.byExtension[ext].add(total)
+}
+
+// printTalliesBySize prints tallies largest first.
+func printTalliesBySize(tallies map[string]*fileTally) {
+	names := make([]string, 0, len(tallies))
+	for name := range tallies {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if tallies[names[i]].size == tallies[names[j]].size {
+			return names[i] < names[j]
+		}
+		return tallies[names[i]].size > tallies[names[j]].size
+	})
+	for _, name := range names {
+		fmt.Printf("        %s: %s (%d items)\n", name, formatBytes(tallies[name].size), tallies[name].count)
+	}
+}
+
+// print reports the total with a breakdown by extension and, from the xattr
+// census, by attribute.
+func (r *metadataRisk) print(census map[string]*fileTally) {
+	fmt.Printf("\nMetadata at risk: %s in resource forks and xattrs on %d items, lost by a naive copy to a non-Mac filesystem.\n", formatBytes(r.size), r.files)
+	fmt.Println("    By extension:")
+	printTalliesBySize(r.byExtension)
+	fmt.Println("    By attribute:")
+	printTalliesBySize(census)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricsRegistry collects what the daemon and watch modes expose on
+// /metrics in the Prometheus text format: the latest scan of each directory
+// and running totals for watched files.
+type metricsRegistry struct {
+	mu            sync.Mutex
+	scans         map[string]*scanReport
+	watchChecked  int
+	watchFindings map[string]int
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{scans: map[string]*scanReport{}, watchFindings: map[string]int{}}
+}
+
+func (m *metricsRegistry) recordScan(report *scanReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scans[report.Root] = report
+}
+
+func (m *metricsRegistry) recordWatched(errors, warns []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchChecked++
+	for _, msg := range append(append([]string{}, errors...), warns...) {
+		m.watchFindings[findingRule(msg)]++
+	}
+}
+
+func metricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	dirs := make([]string, 0, len(m.scans))
+	for dir := range m.scans {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	gauge := func(name, help string, value func(report *scanReport) float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, dir := range dirs {
+			fmt.Fprintf(w, "%s{dir=\"%s\"} %g\n", name, metricLabel(dir), value(m.scans[dir]))
+		}
+	}
+	if len(dirs) > 0 {
+		gauge("weirdfs_files_scanned", "Files scanned in the latest scan.", func(r *scanReport) float64 { return float64(r.Files) })
+		gauge("weirdfs_dirs_scanned", "Directories scanned in the latest scan.", func(r *scanReport) float64 { return float64(r.Dirs) })
+		gauge("weirdfs_scan_errors", "Paths that could not be scanned in the latest scan.", func(r *scanReport) float64 { return float64(r.Errors) })
+		gauge("weirdfs_scan_duration_seconds", "Duration of the latest scan.", func(r *scanReport) float64 { return r.Finished.Sub(r.Started).Seconds() })
+		gauge("weirdfs_resource_fork_bytes", "Bytes held in resource forks, which are lost when copying to other filesystems.", func(r *scanReport) float64 { return float64(r.ResourceForkBytes) })
+		gauge("weirdfs_last_scan_timestamp_seconds", "Unix time the latest scan finished.", func(r *scanReport) float64 { return float64(r.Finished.Unix()) })
+
+		fmt.Fprintln(w, "# HELP weirdfs_findings Errors and warnings in the latest scan by rule.\n# TYPE weirdfs_findings gauge")
+		for _, dir := range dirs {
+			counts := map[string]int{}
+			for _, entry := range m.scans[dir].Entries {
+				for _, msg := range entry.findings() {
+					counts[findingRule(msg)]++
+				}
+			}
+			for _, rule := range sortedKeys(counts) {
+				fmt.Fprintf(w, "weirdfs_findings{dir=\"%s\",rule=\"%s\"} %d\n", metricLabel(dir), metricLabel(rule), counts[rule])
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP weirdfs_watch_checked_total Files checked by watch mode.\n# TYPE weirdfs_watch_checked_total counter\nweirdfs_watch_checked_total %d\n", m.watchChecked)
+	fmt.Fprintln(w, "# HELP weirdfs_watch_findings_total Errors and warnings found by watch mode by rule.\n# TYPE weirdfs_watch_findings_total counter")
+	for _, rule := range sortedKeys(m.watchFindings) {
+		fmt.Fprintf(w, "weirdfs_watch_findings_total{rule=\"%s\"} %d\n", metricLabel(rule), m.watchFindings[rule])
+	}
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveMetrics exposes the registry on /metrics at addr in the background.
+func serveMetrics(addr string, metrics *metricsRegistry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go func() {
+		check(http.ListenAndServe(addr, mux))
+	}()
+	fmt.Printf("Serving metrics at http://%s/metrics\n", addr)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const netatalkAppleDouble = ".AppleDouble"
+
+// Directories created by netatalk (AFP file sharing on Linux/Unix servers)
+var netatalkArtifacts = []string{
+	netatalkAppleDouble,
+	".AppleDB",
+	".AppleDesktop",
+	"Network Trash Folder",
+	"Temporary Items",
+	"TheFindByContentFolder",
+	"TheVolumeSettingsFolder",
+}
+
+// netatalk encodes characters that are illegal on the host as ":xx" (CAP encoding)
+var capEncodedChar = regexp.MustCompile(":([0-9a-fA-F]{2})")
+
+// netatalkReport summarizes netatalk artifacts found during a scan.
+type netatalkReport struct {
+	artifacts fileTally
+	withData  int
+	orphaned  int
+}
+
+func isNetatalkArtifact(basename string) bool {
+	for _, name := range netatalkArtifacts {
+		if basename == name {
+			return true
+		}
+	}
+	return false
+}
+
+// capDecode returns the byte the ":xx" at start in basename encodes, if it is
+// one netatalk would have encoded: a non-ASCII byte, a control character, a
+// character reserved on the host, or a leading dot, which would hide the
+// file. Anything else, like the ":30" in "Meeting 10:30", is an ordinary
+// name.
+func capDecode(basename string, start int) (byte, bool) {
+	decoded, err := hex.DecodeString(basename[start+1 : start+3])
+	if err != nil {
+		return 0, false
+	}
+	c := decoded[0]
+	return c, c >= 0x80 || c < 0x20 || c == 0x7f || c == '/' || c == ':' || (c == '.' && start == 0)
+}
+
+func isCAPEncodedName(basename string) bool {
+	for _, loc := range capEncodedChar.FindAllStringIndex(basename, -1) {
+		if _, ok := capDecode(basename, loc[0]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeCAPName(basename string) string {
+	decoded := []byte{}
+	last := 0
+	for _, loc := range capEncodedChar.FindAllStringIndex(basename, -1) {
+		if c, ok := capDecode(basename, loc[0]); ok {
+			decoded = append(append(decoded, basename[last:loc[0]]...), c)
+			last = loc[1]
+		}
+	}
+	return string(append(decoded, basename[last:]...))
+}
+
+// dirSize returns the total size and number of regular files below path.
+func dirSize(path string) (size int64, files int) {
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+// checkNetatalkDir reports on a netatalk artifact directory. For .AppleDouble
+// directories it counts how many entries still describe an existing file and
+// with undo set, merges them into native xattrs, moving the merged entries to
+// the quarantine area.
+func checkNetatalkDir(path string, undo *undoContext, report *netatalkReport) (logs, warns []string) {
+	size, files := dirSize(path)
+	report.artifacts.add(size)
+	warns = append(warns, fmt.Sprintf("netatalk artifact (%d files, %s).", files, formatBytes(size)))
+	if filepath.Base(path) != netatalkAppleDouble {
+		return logs, warns
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err))
+	}
+	parent := filepath.Dir(path)
+	merged := 0
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		// .Parent holds the metadata for the enclosing directory itself
+		dataPath := parent
+		if entry.Name() != ".Parent" {
+			dataPath = filepath.Join(parent, entry.Name())
+		}
+		if _, err := os.Lstat(dataPath); err != nil {
+			report.orphaned++
+			continue
+		}
+		report.withData++
+		if undo == nil {
+			continue
+		}
+		sidecar := filepath.Join(path, entry.Name())
+		ad, err := readAppleDouble(sidecar)
+		if err == nil {
+			err = ad.mergeInto(dataPath, undo)
+		}
+		if err == nil {
+			err = undo.remove(sidecar)
+		}
+		if err != nil {
+			warns = append(warns, fmt.Sprintf("Error merging AppleDouble entry '%s': %s", entry.Name(), err))
+			continue
+		}
+		merged++
+	}
+	if undo != nil {
+		logs = append(logs, fmt.Sprintf("Merged %d netatalk AppleDouble entries into native xattrs", merged))
+		// only once every entry has been merged
+		if remaining, err := ioutil.ReadDir(path); err == nil && len(remaining) == 0 {
+			if err := undo.remove(path); err != nil {
+				warns = append(warns, fmt.Sprintf("Error removing .AppleDouble directory: %s", err))
+			}
+		}
+	}
+	return logs, warns
+}
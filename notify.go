@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+)
+
+// notifier sends a summary of findings to a webhook and/or by email.
+// Findings are collected with add and sent together by flush; the caller
+// says which findings they are (all of a scan's, or only new ones).
+type notifier struct {
+	webhook    *string
+	smtpServer *string
+	emailFrom  *string
+	emailTo    *string
+	level      *string
+	findings   map[string][]string
+}
+
+// addNotifyFlags registers the notification flags on flags, so scan, watch,
+// and daemon all configure them the same way.
+func addNotifyFlags(flags *flag.FlagSet) *notifier {
+	return &notifier{
+		webhook:    flags.String("notifyWebhook", "", "POST a JSON summary of findings (new ones only, for daemon) to this URL (Slack-compatible 'text' field)"),
+		smtpServer: flags.String("notifySMTP", "", "Email a summary of findings (new ones only, for daemon) through this SMTP server (host:port); credentials are read from WEIRDFS_SMTP_USER and WEIRDFS_SMTP_PASSWORD"),
+		emailFrom:  flags.String("notifyFrom", "weirdfs@localhost", "Sender address for -notifySMTP"),
+		emailTo:    flags.String("notifyTo", "", "Comma-separated recipients for -notifySMTP"),
+		level:      flags.String("notifyLevel", "warn", "Lowest severity that triggers a notification: warn or error"),
+		findings:   map[string][]string{},
+	}
+}
+
+// checkLevel rejects a -notifyLevel other than warn or error.
+func (n *notifier) checkLevel() {
+	if *n.level != "warn" && *n.level != "error" {
+		check(fmt.Errorf("unknown -notifyLevel '%s'; expected warn or error", *n.level))
+	}
+}
+
+func (n *notifier) enabled() bool {
+	return *n.webhook != "" || (*n.smtpServer != "" && *n.emailTo != "")
+}
+
+// add records the findings for path that meet the severity threshold.
+func (n *notifier) add(path string, errors, warns []string) {
+	findings := errors
+	if *n.level != "error" {
+		findings = append(append([]string{}, errors...), warns...)
+	}
+	if len(findings) > 0 {
+		n.findings[path] = append(n.findings[path], findings...)
+	}
+}
+
+// summary describes the collected findings in a few lines: totals, the most
+// common rules, and where to find the full report. scope describes the
+// findings, e.g. "new findings".
+func (n *notifier) summary(title, scope, reportPath string) string {
+	total := 0
+	rules := map[string]int{}
+	for _, findings := range n.findings {
+		for _, msg := range findings {
+			total++
+			rules[findingRule(msg)]++
+		}
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s: %d %s on %d paths\n", title, total, scope, len(n.findings))
+	names := sortedKeys(rules)
+	sort.SliceStable(names, func(i, j int) bool { return rules[names[i]] > rules[names[j]] })
+	for i, rule := range names {
+		if i == 5 {
+			fmt.Fprintf(&text, "    ... and %d more rules\n", len(names)-i)
+			break
+		}
+		fmt.Fprintf(&text, "    %s: %d\n", rule, rules[rule])
+	}
+	if reportPath != "" {
+		fmt.Fprintf(&text, "Full report: %s\n", reportPath)
+	}
+	return text.String()
+}
+
+// flush sends any collected findings and clears them. Failures to notify are
+// printed rather than stopping a scan or watch session.
+func (n *notifier) flush(title, scope, reportPath string) {
+	if !n.enabled() || len(n.findings) == 0 {
+		return
+	}
+	text := n.summary(title, scope, reportPath)
+	if *n.webhook != "" {
+		if err := n.postWebhook(title, text, reportPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error sending webhook notification: %s\n", err)
+		}
+	}
+	if *n.smtpServer != "" && *n.emailTo != "" {
+		if err := n.sendEmail(title, text); err != nil {
+			fmt.Fprintf(os.Stderr, "Error sending email notification: %s\n", err)
+		}
+	}
+	n.findings = map[string][]string{}
+}
+
+func (n *notifier) postWebhook(title, text, reportPath string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"text":     text,
+		"title":    title,
+		"report":   reportPath,
+		"findings": n.findings,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(*n.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", *n.webhook, resp.Status)
+	}
+	return nil
+}
+
+func (n *notifier) sendEmail(title, text string) error {
+	to := splitList(*n.emailTo)
+	var auth smtp.Auth
+	if user := os.Getenv("WEIRDFS_SMTP_USER"); user != "" {
+		host := strings.Split(*n.smtpServer, ":")[0]
+		auth = smtp.PlainAuth("", user, os.Getenv("WEIRDFS_SMTP_PASSWORD"), host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
+		*n.emailFrom, strings.Join(to, ", "), title, strings.Replace(text, "\n", "\r\n", -1))
+	return smtp.SendMail(*n.smtpServer, auth, *n.emailFrom, to, []byte(msg))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// postNotification shows a Notification Center message via osascript.
+func postNotification(title, message string) error {
+	script := fmt.Sprintf("display notification %s with title %s sound name \"default\"",
+		appleScriptString(message), appleScriptString(title))
+	return exec.Command("osascript", "-e", script).Run()
+}
+
+// notifyOnAbort posts a notification if the scan is interrupted or fails,
+// and returns a function to call from a deferred recover in the scan.
+func notifyOnAbort(dir string) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		postNotification("weirdfs scan aborted", fmt.Sprintf("Scan of %s was stopped (%s).", dir, sig))
+		os.Exit(1)
+	}()
+	return func() {
+		if r := recover(); r != nil {
+			postNotification("weirdfs scan failed", fmt.Sprintf("Scan of %s failed: %v", dir, r))
+			panic(r)
+		}
+	}
+}
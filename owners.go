@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// ownerReport tallies items by owning user and group, and those whose
+// owner doesn't exist on this system, caching lookups by ID.
+type ownerReport struct {
+	users   map[uint32]string
+	groups  map[uint32]string
+	unknown map[string]*fileTally
+	byUser  map[string]*fileTally
+	byGroup map[string]*fileTally
+}
+
+func newOwnerReport() *ownerReport {
+	return &ownerReport{
+		users:   map[uint32]string{},
+		groups:  map[uint32]string{},
+		unknown: map[string]*fileTally{},
+		byUser:  map[string]*fileTally{},
+		byGroup: map[string]*fileTally{},
+	}
+}
+
+// userName returns the name of a user, or "" if it has no account.
+func (r *ownerReport) userName(uid uint32) string {
+	name, ok := r.users[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.Itoa(int(uid))); err == nil {
+			name = u.Username
+		}
+		r.users[uid] = name
+	}
+	return name
+}
+
+// groupName returns the name of a group, or "" if it doesn't exist.
+func (r *ownerReport) groupName(gid uint32) string {
+	name, ok := r.groups[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.Itoa(int(gid))); err == nil {
+			name = g.Name
+		}
+		r.groups[gid] = name
+	}
+	return name
+}
+
+func tallyOwner(tallies map[string]*fileTally, owner string, size int64) {
+	if tallies[owner] == nil {
+		tallies[owner] = &fileTally{}
+	}
+	tallies[owner].add(size)
+}
+
+// ownerLabel names an owner by ID and name, or flags it as having no
+// account.
+func ownerLabel(kind string, id uint32, name string) string {
+	if name == "" {
+		return fmt.Sprintf("%s %d (no account)", kind, id)
+	}
+	return fmt.Sprintf("%s %d (%s)", kind, id, name)
+}
+
+// checkOwner flags items owned by a UID or GID with no account, usually
+// left over from an old machine or a deleted user.
+func (r *ownerReport) checkOwner(info os.FileInfo) (logs, warns []string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return logs, warns
+	}
+	userName := r.userName(stat.Uid)
+	groupName := r.groupName(stat.Gid)
+	tallyOwner(r.byUser, ownerLabel("uid", stat.Uid, userName), info.Size())
+	tallyOwner(r.byGroup, ownerLabel("gid", stat.Gid, groupName), info.Size())
+	if userName == "" {
+		tallyOwner(r.unknown, fmt.Sprintf("uid %d", stat.Uid), info.Size())
+		warns = append(warns, fmt.Sprintf("Owned by unknown user (uid %d); ownership will be meaningless or wrong on the new system.", stat.Uid))
+	}
+	if groupName == "" {
+		tallyOwner(r.unknown, fmt.Sprintf("gid %d", stat.Gid), info.Size())
+		warns = append(warns, fmt.Sprintf("Owned by unknown group (gid %d); group permissions will be meaningless or wrong on the new system.", stat.Gid))
+	}
+	return logs, warns
+}
+
+func printOwnerTallies(tallies map[string]*fileTally) {
+	owners := make([]string, 0, len(tallies))
+	for owner := range tallies {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		fmt.Printf("    %s: %d (%s)\n", owner, tallies[owner].count, formatBytes(tallies[owner].size))
+	}
+}
+
+func (r *ownerReport) print() {
+	fmt.Println("\nOwners with no account on this system:")
+	printOwnerTallies(r.unknown)
+}
+
+// printDistribution prints the items and bytes owned by each user and group,
+// to plan UID and GID remapping for a migration.
+func (r *ownerReport) printDistribution() {
+	fmt.Println("\nItems by owner:")
+	printOwnerTallies(r.byUser)
+	fmt.Println("\nItems by group:")
+	printOwnerTallies(r.byGroup)
+}
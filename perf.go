@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const slowDirListLength = 10
+
+// Time spent waiting on external commands (DeRez, file, hdiutil, ...) by
+// command name. Scans run in a single goroutine.
+var commandTimes = map[string]time.Duration{}
+
+// timeCommand records the time since start against an external command;
+// call it deferred with time.Now() right before running the command.
+func timeCommand(name string, start time.Time) {
+	commandTimes[name] += time.Since(start)
+}
+
+type dirTime struct {
+	Path    string  `json:"path"`
+	Seconds float64 `json:"seconds"`
+}
+
+// scanPerformance records how long a scan took and where the time went, to
+// tune ignore lists and compare hardware for big audits.
+type scanPerformance struct {
+	ElapsedSeconds float64            `json:"elapsedSeconds"`
+	FilesPerSecond float64            `json:"filesPerSecond"`
+	BytesExamined  int64              `json:"bytesExamined"`
+	CommandSeconds map[string]float64 `json:"commandSeconds,omitempty"`
+	SlowestDirs    []dirTime          `json:"slowestDirs,omitempty"`
+	dirTimes       map[string]time.Duration
+}
+
+func newScanPerformance() *scanPerformance {
+	return &scanPerformance{dirTimes: map[string]time.Duration{}}
+}
+
+// timeEntry records the time since start, spent on one entry, against the
+// directory holding it.
+func (p *scanPerformance) timeEntry(dir string, start time.Time) {
+	p.dirTimes[dir] += time.Since(start)
+}
+
+// finish computes the totals once the walk is done.
+func (p *scanPerformance) finish(started time.Time, files int) {
+	elapsed := time.Since(started)
+	p.ElapsedSeconds = elapsed.Seconds()
+	if elapsed > 0 {
+		p.FilesPerSecond = float64(files) / elapsed.Seconds()
+	}
+	p.CommandSeconds = map[string]float64{}
+	for name, d := range commandTimes {
+		p.CommandSeconds[name] = d.Seconds()
+	}
+	for dir, d := range p.dirTimes {
+		p.SlowestDirs = append(p.SlowestDirs, dirTime{dir, d.Seconds()})
+	}
+	sort.Slice(p.SlowestDirs, func(i, j int) bool { return p.SlowestDirs[i].Seconds > p.SlowestDirs[j].Seconds })
+	if len(p.SlowestDirs) > slowDirListLength {
+		p.SlowestDirs = p.SlowestDirs[:slowDirListLength]
+	}
+}
+
+func (p *scanPerformance) print() {
+	fmt.Printf("\nScan performance: %s elapsed, %.1f files/sec, %s examined.\n",
+		time.Duration(p.ElapsedSeconds*float64(time.Second)).Round(time.Millisecond), p.FilesPerSecond, formatBytes(p.BytesExamined))
+	if len(p.CommandSeconds) > 0 {
+		fmt.Println("    Time in external commands:")
+		names := make([]string, 0, len(p.CommandSeconds))
+		for name := range p.CommandSeconds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("        %s: %.1fs\n", name, p.CommandSeconds[name])
+		}
+	}
+	if len(p.SlowestDirs) > 0 {
+		fmt.Println("    Slowest directories (time on their direct entries):")
+		for _, dir := range p.SlowestDirs {
+			fmt.Printf("        %.1fs  %s\n", dir.Seconds, dir.Path)
+		}
+	}
+}
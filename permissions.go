@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// access(2) mode bits from <unistd.h>
+const (
+	accessRead    = 0x4
+	accessExecute = 0x1
+)
+
+// checkPermissions flags mode bits that break things or open holes after a
+// move: setuid and setgid, sticky bits, world-writable items, and items the
+// scanning user can't read. counts tallies each rule.
+func checkPermissions(path string, info os.FileInfo, counts map[string]int) (logs, warns []string) {
+	mode := info.Mode()
+	if mode&os.ModeSetuid != 0 {
+		counts["setuid"]++
+		warns = append(warns, fmt.Sprintf("Setuid (%s); runs as its owner, which will differ on the new system.", mode))
+	}
+	if mode&os.ModeSetgid != 0 {
+		counts["setgid"]++
+		warns = append(warns, fmt.Sprintf("Setgid (%s); runs or creates files as its group, which will differ on the new system.", mode))
+	}
+	if mode&os.ModeSticky != 0 {
+		counts["sticky"]++
+		logs = append(logs, fmt.Sprintf("Sticky bit (%s)", mode))
+	}
+	if mode.Perm()&0002 != 0 {
+		counts["world-writable"]++
+		warns = append(warns, fmt.Sprintf("World-writable (%s); anyone on the new system can change it.", mode))
+	}
+	want := uint32(accessRead)
+	if info.IsDir() {
+		want |= accessExecute
+	}
+	if err := syscall.Access(path, want); err != nil {
+		counts["unreadable"]++
+		warns = append(warns, fmt.Sprintf("Not readable by the scanning user (%s); it will be skipped or fail to copy.", mode))
+	}
+	return logs, warns
+}
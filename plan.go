@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var planHeader = []string{"action", "path", "new_path", "xattrs", "reason", "size", "mtime"}
+
+// writePlan saves proposed fix actions for review instead of applying them.
+// CSV plans can be edited and run with 'weirdfs apply'; shell plans can be
+// run directly, and back up each xattr as hex before deleting it.
+func writePlan(actions []fixAction, output, format string) error {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(output), ".")
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case "csv":
+		w := csv.NewWriter(f)
+		w.Write(planHeader)
+		for _, action := range actions {
+			w.Write([]string{
+				action.kind,
+				action.path,
+				action.newPath,
+				strings.Join(action.xattrs, ","),
+				action.reason,
+				strconv.FormatInt(action.size, 10),
+				action.modTime.Format(time.RFC3339Nano),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	case "sh":
+		fmt.Fprintln(f, "#!/bin/sh")
+		fmt.Fprintf(f, "# Fix plan generated by weirdfs on %s\n", time.Now().Format(time.RFC1123))
+		backups := 0
+		for _, action := range actions {
+			if action.kind == fixStripXattr && backups == 0 {
+				fmt.Fprintln(f, "\n# Deleted xattrs are saved here first; restore one with the command beside it.")
+				fmt.Fprintf(f, "backup=${WEIRDFS_BACKUP:-%s}\n", shellQuote(output+".xattrs"))
+				fmt.Fprintln(f, `mkdir -p "$backup" || exit 1`)
+			}
+			fmt.Fprintf(f, "\n# %s\n", action.reason)
+			switch action.kind {
+			case fixRename:
+				fmt.Fprintf(f, "mv -n -- %s %s\n", shellQuote(action.path), shellQuote(action.newPath))
+			case fixUnlock:
+				fmt.Fprintf(f, "chflags nouchg %s\n", shellQuote(action.path))
+			case fixUnhide:
+				fmt.Fprintf(f, "chflags nohidden %s\n", shellQuote(action.path))
+			case fixMakeVisible:
+				fmt.Fprintf(f, "SetFile -a v %s\n", shellQuote(action.path))
+			case fixStripXattr:
+				for _, name := range action.xattrs {
+					backups++
+					backup := fmt.Sprintf(`"$backup/%d.hex"`, backups)
+					fmt.Fprintf(f, "# restore: xattr -wx %s \"$(cat %s)\" %s\n", shellQuote(name), backup, shellQuote(action.path))
+					fmt.Fprintf(f, "xattr -px %s %s > %s && xattr -d %s %s\n",
+						shellQuote(name), shellQuote(action.path), backup, shellQuote(name), shellQuote(action.path))
+				}
+			default:
+				fmt.Fprintf(f, "# unsupported in shell plans: %s %s\n", action.kind, action.path)
+			}
+		}
+		return f.Chmod(0755)
+	}
+	return fmt.Errorf("unknown plan format '%s'; expected csv or sh", format)
+}
+
+func readPlan(path string) ([]fixAction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = len(planHeader)
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	actions := []fixAction{}
+	for i, row := range rows {
+		if i == 0 && row[0] == planHeader[0] {
+			continue
+		}
+		size, err := strconv.ParseInt(row[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid size '%s'", i+1, row[5])
+		}
+		modTime, err := time.Parse(time.RFC3339Nano, row[6])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid mtime '%s'", i+1, row[6])
+		}
+		actions = append(actions, fixAction{
+			kind:    row[0],
+			path:    row[1],
+			newPath: row[2],
+			xattrs:  splitList(row[3]),
+			reason:  row[4],
+			size:    size,
+			modTime: modTime,
+		})
+	}
+	return actions, nil
+}
+
+// verifyPlannedSource checks that a file is unchanged since the plan was
+// made. Directories are only checked for existence because renaming their
+// contents updates their mtime.
+func verifyPlannedSource(action fixAction) error {
+	info, err := os.Lstat(action.path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	if info.Size() != action.size || !info.ModTime().Equal(action.modTime) {
+		return fmt.Errorf("changed since the plan was made (%s, %v; expected %s, %v)",
+			formatBytes(info.Size()), info.ModTime(), formatBytes(action.size), action.modTime)
+	}
+	return nil
+}
+
+func applyCommand(args []string) {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	journalPath := flags.String("journal", "", "Undo journal to append applied fixes to (default: weirdfs-undo-<time>.jsonl)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs apply [-journal file] <plan.csv>")
+		os.Exit(2)
+	}
+	actions, err := readPlan(flags.Arg(0))
+	check(err)
+	if *journalPath == "" {
+		*journalPath = defaultJournalPath()
+	}
+	journal := openUndoJournal(*journalPath)
+	defer journal.close()
+
+	applied, skipped, failures := 0, 0, 0
+	for _, action := range actions {
+		if err := verifyPlannedSource(action); err != nil {
+			fmt.Println(action.path)
+			log(fmt.Sprintf("Skipped: %s", err), "warn")
+			skipped++
+			continue
+		}
+		if err := applyFixActionJournaled(action, journal); err != nil {
+			fmt.Println(action.path)
+			log(err.Error(), "error")
+			failures++
+			continue
+		}
+		fmt.Println(describeFixAction(action))
+		applied++
+	}
+	fmt.Printf("\nApplied %d of %d planned fixes. %d skipped, %d failures.\n", applied, len(actions), skipped, failures)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf16"
+)
+
+var binaryPlistMagic = []byte("bplist00")
+
+// Binary plist dates count seconds from 2001-01-01 UTC
+var plistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// binaryPlist decodes Apple's binary property list format, which is how most
+// com.apple.metadata xattrs are stored. Values decode to nil, bool, int64,
+// float64, time.Time, []byte, string, []interface{} and
+// map[string]interface{}. The data is untrusted, so references back into an
+// enclosing container are rejected, and the total number of objects decoded
+// is limited so shared references can't multiply into an exponential tree.
+type binaryPlist struct {
+	data        []byte
+	offsets     []uint64
+	refSize     int
+	depthRemain int
+	visiting    map[uint64]bool
+	budget      int
+}
+
+func isBinaryPlist(data []byte) bool {
+	return bytes.HasPrefix(data, binaryPlistMagic)
+}
+
+func parseBinaryPlist(data []byte) (interface{}, error) {
+	if !isBinaryPlist(data) || len(data) < len(binaryPlistMagic)+32 {
+		return nil, errors.New("not a binary plist")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:16])
+	topObject := binary.BigEndian.Uint64(trailer[16:24])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:32])
+	if offsetSize == 0 || refSize == 0 || numObjects > uint64(len(data)) ||
+		tableOffset+numObjects*uint64(offsetSize) > uint64(len(data)) {
+		return nil, errors.New("corrupt binary plist trailer")
+	}
+
+	p := &binaryPlist{data: data, refSize: refSize, depthRemain: 64, visiting: map[uint64]bool{}, budget: 4 * len(data)}
+	p.offsets = make([]uint64, numObjects)
+	for i := range p.offsets {
+		start := tableOffset + uint64(i*offsetSize)
+		p.offsets[i] = readSizedInt(data[start : start+uint64(offsetSize)])
+	}
+	return p.object(topObject)
+}
+
+func readSizedInt(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+func (p *binaryPlist) bytesAt(offset, length uint64) ([]byte, error) {
+	if offset+length > uint64(len(p.data)) || offset+length < offset {
+		return nil, errors.New("binary plist object extends past end of data")
+	}
+	return p.data[offset : offset+length], nil
+}
+
+// length decodes an object's length, which is either the low nibble of the
+// marker or, when that is 0xF, a following integer object.
+func (p *binaryPlist) length(marker byte, offset uint64) (uint64, uint64, error) {
+	n := uint64(marker & 0x0F)
+	if n != 0x0F {
+		return n, offset + 1, nil
+	}
+	intMarker, err := p.bytesAt(offset+1, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	size := uint64(1) << (intMarker[0] & 0x0F)
+	b, err := p.bytesAt(offset+2, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	return readSizedInt(b), offset + 2 + size, nil
+}
+
+func (p *binaryPlist) refs(offset, count uint64) ([]uint64, error) {
+	if count > uint64(len(p.data))/uint64(p.refSize) {
+		return nil, errors.New("binary plist container larger than the data")
+	}
+	b, err := p.bytesAt(offset, count*uint64(p.refSize))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, count)
+	for i := range refs {
+		refs[i] = readSizedInt(b[i*p.refSize : (i+1)*p.refSize])
+	}
+	return refs, nil
+}
+
+func (p *binaryPlist) object(ref uint64) (interface{}, error) {
+	if ref >= uint64(len(p.offsets)) {
+		return nil, fmt.Errorf("binary plist reference %d out of range", ref)
+	}
+	if p.visiting[ref] {
+		return nil, errors.New("binary plist container contains itself")
+	}
+	p.budget--
+	if p.budget < 0 {
+		return nil, errors.New("binary plist expands to too many objects")
+	}
+	p.depthRemain--
+	p.visiting[ref] = true
+	defer func() {
+		p.depthRemain++
+		delete(p.visiting, ref)
+	}()
+	if p.depthRemain < 0 {
+		return nil, errors.New("binary plist nested too deeply")
+	}
+
+	offset := p.offsets[ref]
+	markerBytes, err := p.bytesAt(offset, 1)
+	if err != nil {
+		return nil, err
+	}
+	marker := markerBytes[0]
+
+	switch marker >> 4 {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		b, err := p.bytesAt(offset+1, 1<<(marker&0x0F))
+		if err != nil {
+			return nil, err
+		}
+		return int64(readSizedInt(b)), nil
+	case 0x2:
+		b, err := p.bytesAt(offset+1, 1<<(marker&0x0F))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+		}
+		return math.Float64frombits(readSizedInt(b)), nil
+	case 0x3:
+		b, err := p.bytesAt(offset+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(b))
+		return plistEpoch.Add(time.Duration(seconds * float64(time.Second))), nil
+	case 0x4, 0x5, 0x6:
+		n, start, err := p.length(marker, offset)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(p.data)) {
+			return nil, errors.New("binary plist object extends past end of data")
+		}
+		if marker>>4 == 0x6 {
+			b, err := p.bytesAt(start, n*2)
+			if err != nil {
+				return nil, err
+			}
+			units := make([]uint16, n)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(b[i*2:])
+			}
+			return string(utf16.Decode(units)), nil
+		}
+		b, err := p.bytesAt(start, n)
+		if err != nil {
+			return nil, err
+		}
+		if marker>>4 == 0x5 {
+			return string(b), nil
+		}
+		return b, nil
+	case 0x8:
+		b, err := p.bytesAt(offset+1, uint64(marker&0x0F)+1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readSizedInt(b)), nil
+	case 0xA, 0xC:
+		n, start, err := p.length(marker, offset)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := p.refs(start, n)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, len(refs))
+		for i, r := range refs {
+			if array[i], err = p.object(r); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case 0xD:
+		n, start, err := p.length(marker, offset)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(p.data)) {
+			return nil, errors.New("binary plist container larger than the data")
+		}
+		refs, err := p.refs(start, n*2)
+		if err != nil {
+			return nil, err
+		}
+		dict := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := p.object(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.object(refs[n+i])
+			if err != nil {
+				return nil, err
+			}
+			dict[fmt.Sprint(key)] = value
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("unsupported binary plist marker 0x%02x", marker)
+}
+
+// plistStrings returns the strings in a decoded plist value, which may be a
+// single string or an array of them.
+func plistStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		strs := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scanReport is the machine-readable record of a scan written by -report.
+// Paths are relative to the scanned root so reports of the same tree can be
+// compared even if it was mounted somewhere else.
+type scanReport struct {
+	Root     string    `json:"root"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Files    int       `json:"files"`
+	Dirs     int       `json:"dirs"`
+	Errors   int       `json:"errors"`
+	// extension -> number of files with resource forks
+	ResourceForks     map[string]int `json:"resourceForks,omitempty"`
+	ResourceForkBytes int64          `json:"resourceForkBytes,omitempty"`
+	// per-extension statistics, in -extensionSort order
+	Extensions  []extensionStat  `json:"extensions,omitempty"`
+	Performance *scanPerformance `json:"performance,omitempty"`
+	Entries     []reportEntry    `json:"entries"`
+	index       map[string]int
+}
+
+type reportEntry struct {
+	Path     string    `json:"path"`
+	Dir      bool      `json:"dir,omitempty"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Errors   []string  `json:"errors,omitempty"`
+	Warnings []string  `json:"warnings,omitempty"`
+	Info     []string  `json:"info,omitempty"`
+}
+
+func newScanReport(root string) *scanReport {
+	return &scanReport{Root: root, Started: time.Now().UTC(), Entries: []reportEntry{}, index: map[string]int{}}
+}
+
+func (r *scanReport) relPath(path string) string {
+	rel, err := filepath.Rel(r.Root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// add records findings for path, merging with anything already recorded.
+func (r *scanReport) add(path string, info os.FileInfo, errors, warns, logs []string) {
+	rel := r.relPath(path)
+	i, ok := r.index[rel]
+	if !ok {
+		i = len(r.Entries)
+		r.index[rel] = i
+		r.Entries = append(r.Entries, reportEntry{Path: rel})
+	}
+	entry := &r.Entries[i]
+	if info != nil {
+		entry.Dir = info.IsDir()
+		entry.Size = info.Size()
+		entry.ModTime = info.ModTime()
+	}
+	entry.Errors = append(entry.Errors, errors...)
+	entry.Warnings = append(entry.Warnings, warns...)
+	entry.Info = append(entry.Info, logs...)
+}
+
+func (r *scanReport) write(path string) error {
+	r.Finished = time.Now().UTC()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func readScanReport(path string) *scanReport {
+	data, err := ioutil.ReadFile(path)
+	check(err)
+	report := &scanReport{}
+	check(json.Unmarshal(data, report))
+	report.index = map[string]int{}
+	for i, entry := range report.Entries {
+		report.index[entry.Path] = i
+	}
+	return report
+}
+
+// findings returns the errors and warnings of an entry, which are what diff
+// compares.
+func (e reportEntry) findings() []string {
+	return append(append([]string{}, e.Errors...), e.Warnings...)
+}
+
+// reportDiff is the difference between two scan reports.
+type reportDiff struct {
+	newFindings      map[string][]string
+	resolvedFindings map[string][]string
+	changed          []string
+	added            []string
+	removed          []string
+}
+
+func diffReports(old, new *scanReport) reportDiff {
+	diff := reportDiff{newFindings: map[string][]string{}, resolvedFindings: map[string][]string{}}
+	for _, entry := range new.Entries {
+		oldIndex, existed := old.index[entry.Path]
+		if !existed {
+			diff.added = append(diff.added, entry.Path)
+			if findings := entry.findings(); len(findings) > 0 {
+				diff.newFindings[entry.Path] = findings
+			}
+			continue
+		}
+		oldEntry := old.Entries[oldIndex]
+		if !entry.Dir && (oldEntry.Size != entry.Size || !oldEntry.ModTime.Equal(entry.ModTime)) {
+			diff.changed = append(diff.changed, entry.Path)
+		}
+		for _, finding := range entry.findings() {
+			if !containsString(oldEntry.findings(), finding) {
+				diff.newFindings[entry.Path] = append(diff.newFindings[entry.Path], finding)
+			}
+		}
+		for _, finding := range oldEntry.findings() {
+			if !containsString(entry.findings(), finding) {
+				diff.resolvedFindings[entry.Path] = append(diff.resolvedFindings[entry.Path], finding)
+			}
+		}
+	}
+	for _, entry := range old.Entries {
+		if _, exists := new.index[entry.Path]; !exists {
+			diff.removed = append(diff.removed, entry.Path)
+			if findings := entry.findings(); len(findings) > 0 {
+				diff.resolvedFindings[entry.Path] = findings
+			}
+		}
+	}
+	return diff
+}
+
+func printFindingsByPath(title string, findings map[string][]string, level string) {
+	fmt.Printf("\n%s (%d paths):\n", title, len(findings))
+	paths := make([]string, 0, len(findings))
+	for path := range findings {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Println(path)
+		logMany(findings[path], level)
+	}
+}
+
+func printPathList(title string, paths []string) {
+	fmt.Printf("\n%s: %d\n", title, len(paths))
+	for _, path := range paths {
+		fmt.Printf("    %s\n", path)
+	}
+}
+
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs diff <old.json> <new.json>")
+		os.Exit(2)
+	}
+	old := readScanReport(flags.Arg(0))
+	new := readScanReport(flags.Arg(1))
+	fmt.Printf("Comparing scan of %s at %v with %v\n", new.Root, old.Started, new.Started)
+
+	diff := diffReports(old, new)
+	printFindingsByPath("New findings", diff.newFindings, "warn")
+	printFindingsByPath("Resolved findings", diff.resolvedFindings, "info")
+	printPathList("Changed files", diff.changed)
+	printPathList("Added paths", diff.added)
+	printPathList("Removed paths", diff.removed)
+}
+
+// Findings put their variable details in quotes, parentheses, or after a colon
+// or semicolon, so the text before any of those names the rule.
+var findingDetails = regexp.MustCompile(`[;:('"].*$`)
+
+// findingRule returns the rule a finding message belongs to, e.g. "Name
+// contains illegal character" for "Name contains illegal character ':'.".
+func findingRule(msg string) string {
+	return strings.TrimRight(findingDetails.ReplaceAllString(msg, ""), " .")
+}
+
+// ruleSummary counts findings by rule, with the bytes of the files they
+// were found on.
+type ruleSummary map[string]*fileTally
+
+// add counts the findings on one path; size is 0 for anything but a file.
+func (s ruleSummary) add(errors, warns []string, size int64) {
+	counted := map[string]bool{}
+	for _, msg := range append(append([]string{}, errors...), warns...) {
+		rule := findingRule(msg)
+		if s[rule] == nil {
+			s[rule] = &fileTally{}
+		}
+		s[rule].count++
+		if !counted[rule] {
+			s[rule].size += size
+			counted[rule] = true
+		}
+	}
+}
+
+// rules returns the rules, most findings first.
+func (s ruleSummary) rules() []string {
+	rules := make([]string, 0, len(s))
+	for rule := range s {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if s[rules[i]].count == s[rules[j]].count {
+			return rules[i] < rules[j]
+		}
+		return s[rules[i]].count > s[rules[j]].count
+	})
+	return rules
+}
+
+func (s ruleSummary) print() {
+	fmt.Println("\nFindings by rule:")
+	fmt.Printf("    %9s %10s  %s\n", "findings", "bytes", "rule")
+	for _, rule := range s.rules() {
+		bytes := ""
+		if s[rule].size > 0 {
+			bytes = formatBytes(s[rule].size)
+		}
+		fmt.Printf("    %9d %10s  %s\n", s[rule].count, bytes, rule)
+	}
+}
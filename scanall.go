@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanTarget is a named directory in the scan-all config, with its own
+// ignores and scan flags. A relative dir is relative to the config file.
+type scanTarget struct {
+	Name   string   `json:"name"`
+	Dir    string   `json:"dir"`
+	Ignore []string `json:"ignore,omitempty"`
+	// target profiles to check against, as with -target, e.g. "dropbox"
+	Profile string `json:"profile,omitempty"`
+	// extra scan flags, e.g. ["-reportRepos", "-buildDirs=node_modules"]
+	Flags []string `json:"flags,omitempty"`
+}
+
+type scanTargetConfig struct {
+	Targets []scanTarget `json:"targets"`
+}
+
+// targetReport is one target's segment of a combined scan-all report.
+type targetReport struct {
+	Name   string      `json:"name"`
+	Dir    string      `json:"dir"`
+	Error  string      `json:"error,omitempty"`
+	Report *scanReport `json:"report,omitempty"`
+}
+
+type combinedReport struct {
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Targets  []targetReport `json:"targets"`
+}
+
+func defaultTargetConfigPath() string {
+	usr, err := user.Current()
+	check(err)
+	return filepath.Join(usr.HomeDir, ".weirdfs", "targets.json")
+}
+
+func readScanTargets(path string) ([]scanTarget, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := scanTargetConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for i, target := range config.Targets {
+		if target.Name == "" || target.Dir == "" {
+			return nil, fmt.Errorf("%s: target %d needs a name and a dir", path, i+1)
+		}
+		if !filepath.IsAbs(target.Dir) {
+			config.Targets[i].Dir = filepath.Join(filepath.Dir(path), target.Dir)
+		}
+	}
+	return config.Targets, nil
+}
+
+func (t scanTarget) scanFlags() []string {
+	flags := append([]string{}, t.Flags...)
+	if len(t.Ignore) > 0 {
+		flags = append(flags, "-ignore", strings.Join(t.Ignore, ","))
+	}
+	if t.Profile != "" {
+		flags = append(flags, "-target", t.Profile)
+	}
+	return flags
+}
+
+func printTargetSummary(target targetReport) {
+	fmt.Printf("\n== %s (%s)\n", target.Name, target.Dir)
+	if target.Error != "" {
+		log(target.Error, "error")
+		return
+	}
+	summary := summarizeReport(target.Report)
+	fmt.Printf("    %d directories, %d files, %d scan errors, %d findings, %s in resource forks\n",
+		summary.Dirs, summary.Files, summary.Errors, summary.findings(), formatBytes(summary.ResourceForkBytes))
+	for _, rule := range sortedKeys(summary.Rules) {
+		fmt.Printf("    %s: %d\n", rule, summary.Rules[rule])
+	}
+}
+
+func scanAllCommand(args []string) {
+	flags := flag.NewFlagSet("scan-all", flag.ExitOnError)
+	configPath := flags.String("config", defaultTargetConfigPath(), "JSON file listing the scan targets")
+	parallel := flags.Int("parallel", 1, "Number of targets to scan at once")
+	output := flags.String("output", "weirdfs-scan-all.json", "Write the combined report, segmented by target, to this path")
+	debug := flags.Bool("debug", false, "Show the output of each scan")
+	flags.Parse(args)
+
+	targets, err := readScanTargets(*configPath)
+	check(err)
+	if flags.NArg() > 0 {
+		// only the named targets
+		selected := []scanTarget{}
+		names := []string{}
+		for _, target := range targets {
+			if containsString(flags.Args(), target.Name) {
+				selected = append(selected, target)
+			}
+			names = append(names, target.Name)
+		}
+		for _, name := range flags.Args() {
+			if !containsString(names, name) {
+				check(fmt.Errorf("no target named '%s' in %s (configured: %s)", name, *configPath, strings.Join(names, ", ")))
+			}
+		}
+		targets = selected
+	}
+	if *parallel < 1 {
+		*parallel = 1
+	}
+
+	combined := combinedReport{Started: time.Now().UTC(), Targets: make([]targetReport, len(targets))}
+	slots := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		// take a slot before starting so targets begin in config order
+		slots <- struct{}{}
+		go func(i int, target scanTarget) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			fmt.Printf("Scanning %s (%s)\n", target.Name, target.Dir)
+			result := targetReport{Name: target.Name, Dir: target.Dir}
+			report, err := runScan(scanRoot(target.Dir), target.scanFlags(), *debug && *parallel == 1)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Report = report
+			}
+			combined.Targets[i] = result
+		}(i, target)
+	}
+	wg.Wait()
+	combined.Finished = time.Now().UTC()
+
+	for _, target := range combined.Targets {
+		printTargetSummary(target)
+	}
+	data, err := json.MarshalIndent(combined, "", "  ")
+	check(err)
+	check(ioutil.WriteFile(*output, append(data, '\n'), 0644))
+	fmt.Printf("\nWrote combined report for %d targets to %s\n", len(combined.Targets), *output)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// servedEntry is a report entry as sent to the dashboard, with each finding
+// tagged with its rule so the page can filter on it.
+type servedEntry struct {
+	Path     string          `json:"path"`
+	Dir      bool            `json:"dir"`
+	Size     int64           `json:"size"`
+	Ext      string          `json:"ext"`
+	Findings []servedFinding `json:"findings"`
+}
+
+type servedFinding struct {
+	Level   string `json:"level"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type servedReport struct {
+	Root          string         `json:"root"`
+	Started       string         `json:"started"`
+	Files         int            `json:"files"`
+	Dirs          int            `json:"dirs"`
+	ResourceForks map[string]int `json:"resourceForks"`
+	Extensions    map[string]int `json:"extensions"`
+	Entries       []servedEntry  `json:"entries"`
+}
+
+func buildServedReport(report *scanReport) servedReport {
+	served := servedReport{
+		Root:          report.Root,
+		Started:       report.Started.Format("2006-01-02 15:04"),
+		Files:         report.Files,
+		Dirs:          report.Dirs,
+		ResourceForks: report.ResourceForks,
+		Extensions:    map[string]int{},
+		Entries:       []servedEntry{},
+	}
+	for _, entry := range report.Entries {
+		ext := ""
+		if !entry.Dir {
+			ext = strictFileExtension(entry.Path)
+			served.Extensions[ext]++
+		}
+		findings := []servedFinding{}
+		for _, msg := range entry.Errors {
+			findings = append(findings, servedFinding{"error", findingRule(msg), msg})
+		}
+		for _, msg := range entry.Warnings {
+			findings = append(findings, servedFinding{"warn", findingRule(msg), msg})
+		}
+		if len(findings) == 0 {
+			continue
+		}
+		served.Entries = append(served.Entries, servedEntry{entry.Path, entry.Dir, entry.Size, ext, findings})
+	}
+	return served
+}
+
+func serveCommand(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8080", "Address to serve the dashboard on")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs serve [-listen addr] <report.json>")
+		os.Exit(2)
+	}
+	data, err := json.Marshal(buildServedReport(readScanReport(flags.Arg(0))))
+	check(err)
+
+	http.HandleFunc("/report.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboardPage))
+	})
+	fmt.Printf("Serving %s at http://%s/\n", flags.Arg(0), strings.Replace(*listen, "0.0.0.0", "localhost", 1))
+	check(http.ListenAndServe(*listen, nil))
+}
+
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>weirdfs report</title>
+<style>
+body { font: 14px -apple-system, Helvetica, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+.controls { margin: 1em 0; display: flex; gap: 1em; flex-wrap: wrap; }
+.charts { display: flex; gap: 3em; flex-wrap: wrap; }
+.chart { min-width: 24em; }
+.bar { display: flex; align-items: center; margin: 2px 0; }
+.bar span.label { width: 10em; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.bar span.fill { background: #4a90d9; height: 1em; margin-right: 0.5em; }
+table { border-collapse: collapse; width: 100%; margin-top: 1em; }
+td, th { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+.error { color: #c0392b; }
+.warn { color: #b9770e; }
+</style>
+</head>
+<body>
+<h1 id="title">weirdfs report</h1>
+<div class="charts">
+  <div class="chart"><h2>Files by extension</h2><div id="extensions"></div></div>
+  <div class="chart"><h2>Resource forks by extension</h2><div id="forks"></div></div>
+</div>
+<div class="controls">
+  <input id="search" placeholder="Search paths and findings" size="40">
+  <select id="rule"><option value="">All rules</option></select>
+  <select id="ext"><option value="">All extensions</option></select>
+  <label>Min size (MB) <input id="minSize" type="number" min="0" value="0" style="width:6em"></label>
+  <span id="count"></span>
+</div>
+<table><thead><tr><th>Path</th><th>Size</th><th>Findings</th></tr></thead><tbody id="rows"></tbody></table>
+<script>
+function esc(s) { return String(s).replace(/[&<>"]/g, c => ({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;'}[c])); }
+function size(n) { const u = ['B','KB','MB','GB','TB']; let i = 0; while (n >= 1024 && i < u.length - 1) { n /= 1024; i++; } return n.toFixed(i ? 1 : 0) + ' ' + u[i]; }
+function bars(el, counts, limit) {
+  const items = Object.entries(counts).sort((a, b) => b[1] - a[1]).slice(0, limit);
+  const max = items.length ? items[0][1] : 1;
+  el.innerHTML = items.map(([k, v]) => '<div class="bar"><span class="label">' + esc(k || '(none)') + '</span><span class="fill" style="width:' + (200 * v / max) + 'px"></span>' + v + '</div>').join('') || '(none)';
+}
+fetch('/report.json').then(r => r.json()).then(report => {
+  document.getElementById('title').textContent = report.root + ' (scanned ' + report.started + ', ' + report.files + ' files, ' + report.dirs + ' directories)';
+  bars(document.getElementById('extensions'), report.extensions, 25);
+  bars(document.getElementById('forks'), report.resourceForks || {}, 25);
+  const rules = new Set(), exts = new Set();
+  report.entries.forEach(e => { e.findings.forEach(f => rules.add(f.rule)); exts.add(e.ext); });
+  [...rules].sort().forEach(r => document.getElementById('rule').add(new Option(r, r)));
+  [...exts].sort().forEach(x => document.getElementById('ext').add(new Option(x || '(none)', x)));
+  function render() {
+    const q = document.getElementById('search').value.toLowerCase();
+    const rule = document.getElementById('rule').value;
+    const ext = document.getElementById('ext').value;
+    const minSize = parseFloat(document.getElementById('minSize').value || 0) * 1024 * 1024;
+    const rows = report.entries.filter(e =>
+      (!rule || e.findings.some(f => f.rule === rule)) &&
+      (!ext || e.ext === ext) &&
+      e.size >= minSize &&
+      (!q || e.path.toLowerCase().includes(q) || e.findings.some(f => f.message.toLowerCase().includes(q))));
+    document.getElementById('count').textContent = rows.length + ' of ' + report.entries.length + ' paths';
+    document.getElementById('rows').innerHTML = rows.slice(0, 2000).map(e =>
+      '<tr><td>' + esc(e.path) + '</td><td>' + (e.dir ? '' : size(e.size)) + '</td><td>' +
+      e.findings.filter(f => !rule || f.rule === rule).map(f => '<div class="' + f.level + '">' + esc(f.message) + '</div>').join('') +
+      '</td></tr>').join('');
+  }
+  ['search', 'rule', 'ext', 'minSize'].forEach(id => document.getElementById(id).addEventListener('input', render));
+  render();
+});
+</script>
+</body>
+</html>
+`
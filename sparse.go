@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const (
+	minSparseFileSize = 1024 * 1024
+	// files with less than this fraction of their size allocated are flagged
+	sparseAllocatedRatio = 0.5
+)
+
+// sparseReport tallies files with large unallocated holes.
+type sparseReport struct {
+	files     int
+	apparent  int64
+	allocated int64
+}
+
+// checkSparse compares the blocks allocated to a file with its size.
+// Files with HFS+/APFS transparent compression also use fewer blocks than
+// their size, but aren't sparse, so they are skipped.
+func (r *sparseReport) checkSparse(info os.FileInfo) (logs, warns []string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || info.Size() < minSparseFileSize || stat.Flags&ufCompressed != 0 {
+		return logs, warns
+	}
+	allocated := stat.Blocks * 512
+	if float64(allocated) >= float64(info.Size())*sparseAllocatedRatio {
+		return logs, warns
+	}
+	r.files++
+	r.apparent += info.Size()
+	r.allocated += allocated
+	return logs, append(warns, fmt.Sprintf("Sparse file (%s apparent, %s on disk); copying without sparse support will use the full size.", formatBytes(info.Size()), formatBytes(allocated)))
+}
+
+func (r *sparseReport) print() {
+	fmt.Printf("\nSparse files: %d, %s apparent but %s on disk; copies to filesystems or with tools without sparse support need %s more.\n",
+		r.files, formatBytes(r.apparent), formatBytes(r.allocated), formatBytes(r.apparent-r.allocated))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func specialFileKind(info os.FileInfo) string {
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	}
+	return ""
+}
+
+// checkSpecialFile reports sockets, named pipes, and device nodes, which most
+// archive, copy, and sync tools fail on or silently drop.
+func checkSpecialFile(kind string) (logs, warns []string) {
+	return logs, append(warns, fmt.Sprintf("Special file (%s); most copy, archive, and sync tools will fail on it or drop it.", kind))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	symlinkBroken      = "broken"
+	symlinkLoop        = "loop"
+	symlinkOutside     = "outside the tree"
+	symlinkAbsolute    = "absolute, inside the tree"
+	symlinkOtherVolume = "on another volume"
+	symlinkRelative    = "relative"
+)
+
+// isWithin reports whether path is root or inside it.
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// checkSymlink classifies a symlink by whether its target exists, would
+// still resolve after the tree is moved, and is on the same volume, and
+// flags links to one of their own ancestors, which loop forever in tools
+// that follow links.
+func checkSymlink(path, root string) (logs, warns []string, kind string) {
+	dest, err := os.Readlink(path)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err)), symlinkBroken
+	}
+	resolved := dest
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(path), dest)
+	}
+	target, err := os.Stat(resolved)
+	if err != nil {
+		if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.ELOOP {
+			return logs, append(warns, fmt.Sprintf("Symlink loop: '%s' resolves back to itself.", dest)), symlinkLoop
+		}
+		return logs, append(warns, fmt.Sprintf("Broken symlink: '%s' doesn't exist.", dest)), symlinkBroken
+	}
+	if target.IsDir() {
+		realTarget, err1 := filepath.EvalSymlinks(resolved)
+		realParent, err2 := filepath.EvalSymlinks(filepath.Dir(path))
+		if err1 == nil && err2 == nil && isWithin(realParent, realTarget) {
+			return logs, append(warns, fmt.Sprintf("Symlink loop: '%s' is an ancestor of the link; tools that follow links will recurse forever.", dest)), symlinkLoop
+		}
+	}
+	if parent, err := os.Stat(filepath.Dir(path)); err == nil {
+		if target.Sys().(*syscall.Stat_t).Dev != parent.Sys().(*syscall.Stat_t).Dev {
+			return logs, append(warns, fmt.Sprintf("Symlink to another volume ('%s'); it will break if the tree is copied without that volume.", dest)), symlinkOtherVolume
+		}
+	}
+	if !isWithin(resolved, root) {
+		return logs, append(warns, fmt.Sprintf("Symlink outside the scanned tree ('%s'); it will break if the tree is copied on its own.", dest)), symlinkOutside
+	}
+	if filepath.IsAbs(dest) {
+		return logs, append(warns, fmt.Sprintf("Absolute symlink ('%s'); it will point back to the original once the tree is moved. Make it relative.", dest)), symlinkAbsolute
+	}
+	return append(logs, fmt.Sprintf("Symlink to '%s'", dest)), warns, symlinkRelative
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// syslogSink writes each finding to syslog as key=value fields, so they can
+// be parsed by the log pipeline without knowing the message formats.
+type syslogSink struct {
+	target *string
+	writer *syslog.Writer
+}
+
+func addSyslogFlags(flags *flag.FlagSet) *syslogSink {
+	return &syslogSink{
+		target: flags.String("syslog", "", "Send findings to syslog: 'local', or a remote server as udp://host:514 or tcp://host:514"),
+	}
+}
+
+// open connects to the configured syslog; it does nothing if -syslog wasn't
+// given.
+func (s *syslogSink) open() {
+	if *s.target == "" {
+		return
+	}
+	network, addr := "", ""
+	if *s.target != "local" {
+		u, err := url.Parse(*s.target)
+		if err != nil || u.Host == "" || (u.Scheme != "udp" && u.Scheme != "tcp") {
+			check(fmt.Errorf("invalid -syslog target %q", *s.target))
+		}
+		network, addr = u.Scheme, u.Host
+	}
+	var err error
+	s.writer, err = syslog.Dial(network, addr, syslog.LOG_WARNING|syslog.LOG_USER, "weirdfs")
+	check(err)
+}
+
+func (s *syslogSink) send(root, path string, errors, warns []string) {
+	if s.writer == nil {
+		return
+	}
+	host, _ := os.Hostname()
+	for _, msg := range errors {
+		s.writer.Err(syslogFields(host, root, path, "error", msg))
+	}
+	for _, msg := range warns {
+		s.writer.Warning(syslogFields(host, root, path, "warn", msg))
+	}
+}
+
+func syslogFields(host, root, path, level, msg string) string {
+	return fmt.Sprintf("host=%s root=%s path=%s level=%s rule=%s msg=%s",
+		strconv.Quote(host), strconv.Quote(root), strconv.Quote(path), level, strconv.Quote(findingRule(msg)), strconv.Quote(msg))
+}
+
+func (s *syslogSink) close() {
+	if s.writer != nil {
+		s.writer.Close()
+	}
+}
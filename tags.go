@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/xattr"
+)
+
+const userTagsXattr = "com.apple.metadata:_kMDItemUserTags"
+
+// Finder tag color indices as stored after the newline in each tag
+var finderTagColors = []string{"", "Gray", "Green", "Purple", "Blue", "Yellow", "Red", "Orange"}
+
+type finderTag struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+func (t finderTag) String() string {
+	if t.Color == "" || t.Color == t.Name {
+		return t.Name
+	}
+	return fmt.Sprintf("%s (%s)", t.Name, t.Color)
+}
+
+type taggedFile struct {
+	Path string      `json:"path"`
+	Tags []finderTag `json:"tags"`
+	raw  []byte
+}
+
+func parseFinderTags(raw []byte) ([]finderTag, error) {
+	value, err := parseBinaryPlist(raw)
+	if err != nil {
+		return nil, err
+	}
+	tags := []finderTag{}
+	for _, s := range plistStrings(value) {
+		tag := finderTag{Name: s}
+		if i := strings.LastIndex(s, "\n"); i > -1 {
+			tag.Name = s[:i]
+			if color, err := strconv.Atoi(s[i+1:]); err == nil && color > 0 && color < len(finderTagColors) {
+				tag.Color = finderTagColors[color]
+			}
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func checkFinderTags(path string, attrs []string) (logs, warns []string, tagged *taggedFile) {
+	if !containsString(attrs, userTagsXattr) {
+		return logs, warns, nil
+	}
+	raw, err := xattr.Get(path, userTagsXattr)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error: %s", err)), nil
+	}
+	tags, err := parseFinderTags(raw)
+	if err != nil {
+		return logs, append(warns, fmt.Sprintf("Error decoding Finder tags: %s", err)), nil
+	}
+	if len(tags) == 0 {
+		return logs, warns, nil
+	}
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.String()
+	}
+	logs = append(logs, fmt.Sprintf("Finder tags: %s", strings.Join(names, ", ")))
+	return logs, warns, &taggedFile{Path: path, Tags: tags, raw: raw}
+}
+
+// exportFinderTags writes tagged files as CSV, JSON, or a shell script that
+// re-applies the original tag xattrs with the xattr tool.
+func exportFinderTags(files []taggedFile, output, format string) error {
+	if format != "sh" {
+		rows := [][]string{}
+		for _, file := range files {
+			for _, tag := range file.Tags {
+				rows = append(rows, []string{file.Path, tag.Name, tag.Color})
+			}
+		}
+		return exportRecords(output, format, files, []string{"path", "tag", "color"}, rows)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintln(f, "#!/bin/sh")
+	fmt.Fprintln(f, "# Re-apply Finder tags exported by weirdfs")
+	for _, file := range files {
+		fmt.Fprintf(f, "xattr -wx %s %s %s\n", userTagsXattr, hex.EncodeToString(file.raw), shellQuote(file.Path))
+	}
+	return f.Chmod(0755)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// targetProfile describes the constraints of a destination the tree is going
+// to be copied or synced to, selected with -target.
+type targetProfile struct {
+	name        string
+	description string
+	// characters names may not contain, or end with
+	illegalChars  string
+	trailingChars string
+	// characters names may not start with
+	leadingChars string
+	// name patterns the target rejects, matched case-insensitively against
+	// the name with and without its extension
+	reservedNames []string
+	// file name patterns the target silently skips
+	ignoredPatterns []string
+	// longest relative path the target accepts, in characters, and deepest
+	// nesting of folders (0 for no limit)
+	maxPathLength int
+	maxDepth      int
+	// what happens to symlinks, if they don't simply survive as links
+	symlinks *symlinkHandling
+	// what happens to xattrs and resource forks (nil for size limits, which
+	// don't say)
+	xattrs *xattrPolicy
+	// whether relative paths become object storage keys
+	objectKeys bool
+	// largest file the target can store, and most items it handles in
+	// total (0 for no limit)
+	maxFileSize int64
+	maxItems    int
+	// granularity modification times are stored with (0 if exact enough)
+	mtimeResolution time.Duration
+}
+
+// symlinkHandling is what a target does with symbolic links.
+type symlinkHandling struct {
+	outcome string
+	note    string
+}
+
+// xattrPolicy is what a target does with xattrs: the outcome for particular
+// attribute names, and for all others.
+type xattrPolicy struct {
+	names  map[string]string
+	others string
+}
+
+func (p *xattrPolicy) outcome(name string) string {
+	if outcome, ok := p.names[name]; ok {
+		return outcome
+	}
+	return p.others
+}
+
+const (
+	xattrMacOnly     = "kept for Mac clients only"
+	xattrAppleDouble = "stored via AppleDouble"
+	xattrLost        = "lost"
+)
+
+// xattrOutcomes lists the outcomes in the order they are reported, with what
+// each means for the data.
+var xattrOutcomes = []struct{ outcome, note string }{
+	{xattrMacOnly, "only kept for Mac clients; lost on the web and other platforms"},
+	{xattrAppleDouble, "written to ._ AppleDouble files by the Finder and cp, and lost by rsync"},
+	{xattrLost, "not stored"},
+}
+
+var (
+	// Dropbox syncs xattrs between Mac clients, but not quarantine, and
+	// com.apple.macl is protected by SIP, so no copy carries it.
+	dropboxXattrs = &xattrPolicy{
+		names:  map[string]string{maclXattr: xattrLost, "com.apple.quarantine": xattrLost},
+		others: xattrMacOnly,
+	}
+	// The Finder and cp (through copyfile) pack xattrs into ._ files on
+	// filesystems that can't store them; rsync, without -E, drops them.
+	fatXattrs   = &xattrPolicy{names: map[string]string{maclXattr: xattrLost}, others: xattrAppleDouble}
+	cloudXattrs = &xattrPolicy{others: xattrLost}
+)
+
+const (
+	symlinkDropped = "dropped"
+	symlinkCopied  = "replaced by a copy"
+	symlinkError   = "an error"
+)
+
+// describeSymlink notes where a symlink points, and whether that is outside
+// the scanned tree or missing.
+func describeSymlink(path, root string) string {
+	dest, err := os.Readlink(path)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %s", err)
+	}
+	resolved := dest
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(path), dest)
+	}
+	if _, err := os.Stat(resolved); err != nil {
+		return fmt.Sprintf("points to '%s', which doesn't exist", dest)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Sprintf("points to '%s', outside the scanned tree", dest)
+	}
+	return fmt.Sprintf("points to '%s'", dest)
+}
+
+const (
+	gigabyte = 1024 * 1024 * 1024
+	terabyte = 1024 * gigabyte
+)
+
+var targetProfiles = []*targetProfile{
+	{
+		name:          "dropbox",
+		description:   "Dropbox",
+		illegalChars:  `/\<>:"|?*`,
+		trailingChars: ". ",
+		ignoredPatterns: []string{
+			"desktop.ini", "thumbs.db", "Thumbs.db", ".DS_Store", "icon\r", "Icon\r",
+			".dropbox", ".dropbox.attr", ".dropbox.cache",
+			"*conflicted copy*",
+		},
+		maxPathLength: 260,
+		maxFileSize:   2 * terabyte,
+		maxItems:      300000,
+		symlinks:      &symlinkHandling{"synced as a link", "it only works where the path it points to exists; the web and mobile apps see nothing"},
+		xattrs:        dropboxXattrs,
+		// client_modified is stored in whole seconds
+		mtimeResolution: time.Second,
+	},
+	{
+		name:         "gdrive",
+		description:  "Google Drive",
+		illegalChars: "/",
+		ignoredPatterns: []string{
+			".DS_Store", "desktop.ini", "Thumbs.db", "Icon\r", "~$*", ".~lock.*#",
+		},
+		maxDepth:    100,
+		maxFileSize: 5 * terabyte,
+		// per shared drive
+		maxItems:        500000,
+		symlinks:        &symlinkHandling{symlinkDropped, "Drive for desktop skips symlinks"},
+		xattrs:          cloudXattrs,
+		mtimeResolution: time.Millisecond,
+	},
+	onedriveProfile("onedrive", "OneDrive"),
+	sharepointProfile(),
+	fatProfile("fat32", "FAT32", 4*gigabyte-1, 2*time.Second),
+	fatProfile("exfat", "exFAT", 0, 10*time.Millisecond),
+	{
+		name:        "s3",
+		description: "S3",
+		symlinks:    &symlinkHandling{symlinkCopied, "most upload tools follow the link and upload what it points to"},
+		// objects only carry user metadata headers
+		xattrs:     cloudXattrs,
+		objectKeys: true,
+		// the largest object; uploads over 5 GB must be multipart
+		maxFileSize: 5 * terabyte,
+	},
+}
+
+// Characters AWS recommends avoiding in object keys, or that need URL
+// encoding or special handling by many tools.
+const (
+	objectKeyAvoidChars   = "\\{}^%`[]\"<>~#|"
+	objectKeySpecialChars = "&$@=;:+,? "
+	maxObjectKeyBytes     = 1024
+)
+
+// microsoftReservedNames are rejected by OneDrive and SharePoint.
+var microsoftReservedNames = []string{
+	".lock", "CON", "PRN", "AUX", "NUL",
+	"COM[0-9]", "LPT[0-9]", "desktop.ini", "~$*", "*_vti_*",
+}
+
+func onedriveProfile(name, description string) *targetProfile {
+	return &targetProfile{
+		name:          name,
+		description:   description,
+		illegalChars:  `"*:<>?/\|`,
+		leadingChars:  " ",
+		trailingChars: ". ",
+		reservedNames: microsoftReservedNames,
+		maxPathLength: 400,
+		maxFileSize:   250 * gigabyte,
+		maxItems:      300000,
+		symlinks:      &symlinkHandling{symlinkDropped, "OneDrive skips symlinks"},
+		xattrs:        cloudXattrs,
+		// lastModifiedDateTime is stored in whole seconds
+		mtimeResolution: time.Second,
+	}
+}
+
+// fatProfile is a FAT-family filesystem, e.g. on a transfer drive.
+func fatProfile(name, description string, maxFileSize int64, mtimeResolution time.Duration) *targetProfile {
+	return &targetProfile{
+		name:            name,
+		description:     description,
+		illegalChars:    `"*/:<>?\|`,
+		trailingChars:   ". ",
+		reservedNames:   []string{"CON", "PRN", "AUX", "NUL", "COM[0-9]", "LPT[0-9]"},
+		symlinks:        &symlinkHandling{symlinkError, "FAT filesystems can't store symlinks; cp and rsync fail on them, and the Finder copies what they point to"},
+		xattrs:          fatXattrs,
+		maxFileSize:     maxFileSize,
+		mtimeResolution: mtimeResolution,
+	}
+}
+
+// sharepointProfile is OneDrive's rules plus names SharePoint reserves in
+// document libraries.
+func sharepointProfile() *targetProfile {
+	profile := onedriveProfile("sharepoint", "SharePoint")
+	profile.reservedNames = append(append([]string{}, microsoftReservedNames...), "forms")
+	return profile
+}
+
+// isReservedName matches a name against reserved name patterns, with and
+// without its extension, ignoring case.
+func isReservedName(patterns []string, base string) bool {
+	lower := strings.ToLower(base)
+	stem := strings.TrimSuffix(lower, filepath.Ext(lower))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if matched, _ := filepath.Match(pattern, lower); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, stem); matched && stem != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func findTargetProfile(name string) *targetProfile {
+	for _, profile := range targetProfiles {
+		if profile.name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+func targetProfileNames() string {
+	names := make([]string, len(targetProfiles))
+	for i, profile := range targetProfiles {
+		names[i] = profile.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// sizeLimitProfiles makes a profile for each user-defined file size limit,
+// given as "label=size" (e.g. "email=25MB") or just a size.
+func sizeLimitProfiles(list string) []*targetProfile {
+	profiles := []*targetProfile{}
+	for _, limit := range splitList(list) {
+		label, size := "size limit", limit
+		if i := strings.Index(limit, "="); i > -1 {
+			label, size = limit[:i], limit[i+1:]
+		}
+		maxFileSize, err := parseBytes(size)
+		check(err)
+		profiles = append(profiles, &targetProfile{
+			name:        label,
+			description: fmt.Sprintf("%s (%s)", label, formatBytes(maxFileSize)),
+			maxFileSize: maxFileSize,
+		})
+	}
+	return profiles
+}
+
+func parseTargetProfiles(list string) []*targetProfile {
+	profiles := []*targetProfile{}
+	for _, name := range splitList(list) {
+		profile := findTargetProfile(strings.ToLower(name))
+		if profile == nil {
+			check(fmt.Errorf("unknown target %q; expected one of: %s", name, targetProfileNames()))
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+type mtimeEntry struct {
+	path  string
+	mtime time.Time
+}
+
+// targetTally summarizes what won't make it to a target.
+type targetTally struct {
+	blocked fileTally
+	ignored fileTally
+	lossy   fileTally
+	// files whose modification times will be rounded
+	roundedTimes int
+	// with -equalMtimes, files by directory and rounded modification time
+	roundedMtimes map[string][]mtimeEntry
+	items         int
+	symlinks      int
+	// NFC-normalized object keys seen so far, to the original path
+	keys map[string]string
+	// files carrying each xattr, and its total size
+	xattrs map[string]*fileTally
+}
+
+func (t *targetTally) addXattrs(sizes map[string]int64) {
+	if t.xattrs == nil {
+		t.xattrs = map[string]*fileTally{}
+	}
+	for name, size := range sizes {
+		if t.xattrs[name] == nil {
+			t.xattrs[name] = &fileTally{}
+		}
+		t.xattrs[name].add(size)
+	}
+}
+
+// checkObjectKey reports problems with rel as an object storage key.
+func checkObjectKey(rel string, tally *targetTally) (blocked, warns []string) {
+	key := filepath.ToSlash(rel)
+	if len(key) > maxObjectKeyBytes {
+		blocked = append(blocked, fmt.Sprintf("key is %d bytes, over the %d limit", len(key), maxObjectKeyBytes))
+	}
+	if strings.HasPrefix(key, "./") || strings.Contains(key, "//") {
+		blocked = append(blocked, "key has './' or '//' segments")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			blocked = append(blocked, fmt.Sprintf("key has a '%s' segment", segment))
+		}
+	}
+	base := path.Base(key)
+	avoid := []string{}
+	for _, char := range base {
+		if char < 0x20 || char == 0x7f {
+			avoid = append(avoid, fmt.Sprintf("%U", char))
+		} else if strings.ContainsRune(objectKeyAvoidChars+objectKeySpecialChars, char) && !containsString(avoid, string(char)) {
+			avoid = append(avoid, string(char))
+		}
+	}
+	if len(avoid) > 0 {
+		warns = append(warns, fmt.Sprintf("S3 key needs special handling (contains '%s').", strings.Join(avoid, "', '")))
+	}
+	if !norm.NFC.IsNormalString(key) {
+		warns = append(warns, "S3 key isn't NFC-normalized; it won't match the same name typed or uploaded elsewhere.")
+	}
+	if tally.keys == nil {
+		tally.keys = map[string]string{}
+	}
+	normalized := norm.NFC.String(key)
+	if other, ok := tally.keys[normalized]; ok && other != key {
+		warns = append(warns, fmt.Sprintf("S3 key differs from '%s' only by Unicode normalization.", other))
+	} else {
+		tally.keys[normalized] = key
+	}
+	return blocked, warns
+}
+
+// checkTarget reports what will happen to path, relative to the scanned root,
+// when copied to the target: whether it is rejected, skipped, or loses data.
+// For symlinks, link describes where they point.
+func checkTarget(profile *targetProfile, rel string, info os.FileInfo, xattrNames []string, link string, tally *targetTally) (logs, warns []string) {
+	tally.items++
+	base := filepath.Base(rel)
+	blocked := []string{}
+	if info.Mode()&os.ModeSymlink != 0 && profile.symlinks != nil {
+		tally.symlinks++
+		warns = append(warns, fmt.Sprintf("%s symlink will be %s (%s); %s.", profile.description, profile.symlinks.outcome, link, profile.symlinks.note))
+	}
+	for _, char := range profile.illegalChars {
+		if strings.ContainsRune(base, char) {
+			blocked = append(blocked, fmt.Sprintf("name contains '%c'", char))
+		}
+	}
+	if first, _ := utf8.DecodeRuneInString(base); strings.ContainsRune(profile.leadingChars, first) {
+		blocked = append(blocked, fmt.Sprintf("name starts with '%c'", first))
+	}
+	if last, _ := utf8.DecodeLastRuneInString(base); strings.ContainsRune(profile.trailingChars, last) {
+		blocked = append(blocked, fmt.Sprintf("name ends with '%c'", last))
+	}
+	if isReservedName(profile.reservedNames, base) {
+		blocked = append(blocked, "reserved name")
+	}
+	if length := utf8.RuneCountInString(rel); profile.maxPathLength > 0 && length > profile.maxPathLength {
+		blocked = append(blocked, fmt.Sprintf("path is %d characters, over the %d limit", length, profile.maxPathLength))
+	}
+	if depth := len(strings.Split(rel, string(filepath.Separator))); profile.maxDepth > 0 && depth > profile.maxDepth {
+		blocked = append(blocked, fmt.Sprintf("nested %d levels deep, over the %d limit", depth, profile.maxDepth))
+	}
+	if profile.objectKeys {
+		keyBlocked, keyWarns := checkObjectKey(rel, tally)
+		blocked = append(blocked, keyBlocked...)
+		warns = append(warns, keyWarns...)
+	}
+	if profile.maxFileSize > 0 && info.Mode().IsRegular() && info.Size() > profile.maxFileSize {
+		blocked = append(blocked, fmt.Sprintf("file is %s, over the %s limit", formatBytes(info.Size()), formatBytes(profile.maxFileSize)))
+	}
+	if len(blocked) > 0 {
+		tally.blocked.add(info.Size())
+		warns = append(warns, fmt.Sprintf("%s won't sync: %s.", profile.description, strings.Join(blocked, "; ")))
+	}
+
+	if profile.mtimeResolution > 0 && info.Mode().IsRegular() {
+		rounded := info.ModTime().Truncate(profile.mtimeResolution)
+		if lost := info.ModTime().Sub(rounded); lost >= time.Second {
+			tally.roundedTimes++
+			warns = append(warns, fmt.Sprintf("%s will round the modification time to %v (losing %v); tools comparing times, like rsync, need --modify-window.", profile.description, profile.mtimeResolution, lost))
+		} else if lost > 0 {
+			tally.roundedTimes++
+			logs = append(logs, fmt.Sprintf("%s will round the modification time to %v.", profile.description, profile.mtimeResolution))
+		}
+		if tally.roundedMtimes != nil {
+			key := fmt.Sprintf("%s\x00%d", filepath.Dir(rel), rounded.UnixNano())
+			tally.roundedMtimes[key] = append(tally.roundedMtimes[key], mtimeEntry{rel, info.ModTime()})
+		}
+	}
+
+	if matchesAny(profile.ignoredPatterns, base) {
+		tally.ignored.add(info.Size())
+		logs = append(logs, fmt.Sprintf("%s ignores this file (not synced).", profile.description))
+	}
+
+	if profile.xattrs != nil {
+		byOutcome := map[string][]string{}
+		for _, attr := range xattrNames {
+			outcome := profile.xattrs.outcome(attr)
+			if attr == "com.apple.ResourceFork" {
+				byOutcome[outcome] = append([]string{"resource fork"}, byOutcome[outcome]...)
+			} else {
+				byOutcome[outcome] = append(byOutcome[outcome], attr)
+			}
+		}
+		lossy := false
+		for _, outcome := range xattrOutcomes {
+			lost := byOutcome[outcome.outcome]
+			if len(lost) == 0 {
+				continue
+			}
+			lossy = true
+			warns = append(warns, fmt.Sprintf("%s will lose data: %s (%s).", profile.description, outcome.note, strings.Join(lost, ", ")))
+		}
+		if lossy {
+			tally.lossy.add(info.Size())
+		}
+	}
+	return logs, warns
+}
+
+func printTargetReport(profiles []*targetProfile, tallies map[string]*targetTally) {
+	for _, profile := range profiles {
+		tally := tallies[profile.name]
+		fmt.Printf("\n%s target:\n", profile.description)
+		fmt.Printf("    will not sync: %d items (%s)\n", tally.blocked.count, formatBytes(tally.blocked.size))
+		if profile.maxItems > 0 && tally.items > profile.maxItems {
+			fmt.Printf("    [WARN] %d items in total, over the %d %s handles well\n", tally.items, profile.maxItems, profile.description)
+		}
+		if len(profile.ignoredPatterns) > 0 {
+			fmt.Printf("    ignored by %s: %d items (%s)\n", profile.description, tally.ignored.count, formatBytes(tally.ignored.size))
+		}
+		if profile.xattrs != nil {
+			fmt.Printf("    will lose data: %d items (%s)\n", tally.lossy.count, formatBytes(tally.lossy.size))
+		}
+		if profile.symlinks != nil && tally.symlinks > 0 {
+			fmt.Printf("    symlinks %s: %d\n", profile.symlinks.outcome, tally.symlinks)
+		}
+		if profile.mtimeResolution > 0 {
+			fmt.Printf("    modification times rounded to %v: %d files (tools comparing times, like rsync, need --modify-window)\n", profile.mtimeResolution, tally.roundedTimes)
+		}
+		if profile.xattrs != nil && len(tally.xattrs) > 0 {
+			printXattrSurvival(profile, tally.xattrs)
+		}
+		if tally.roundedMtimes != nil {
+			printEqualMtimes(tally.roundedMtimes)
+		}
+	}
+}
+
+// printXattrSurvival lists each xattr encountered under what the target does
+// with it, with the total bytes in each class.
+func printXattrSurvival(profile *targetProfile, xattrs map[string]*fileTally) {
+	byOutcome := map[string][]string{}
+	totals := map[string]int64{}
+	for name, tally := range xattrs {
+		outcome := profile.xattrs.outcome(name)
+		byOutcome[outcome] = append(byOutcome[outcome], name)
+		totals[outcome] += tally.size
+	}
+	for _, outcome := range xattrOutcomes {
+		names := byOutcome[outcome.outcome]
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		fmt.Printf("    xattrs %s: %d names, %s\n", outcome.outcome, len(names), formatBytes(totals[outcome.outcome]))
+		for _, name := range names {
+			fmt.Printf("        %s: %d files (%s)\n", name, xattrs[name].count, formatBytes(xattrs[name].size))
+		}
+	}
+}
+
+// printEqualMtimes lists files in the same directory whose different
+// modification times will be equal once rounded, which confuses tools that
+// order or compare files by time.
+func printEqualMtimes(rounded map[string][]mtimeEntry) {
+	keys := []string{}
+	for key, entries := range rounded {
+		for _, entry := range entries[1:] {
+			if !entry.mtime.Equal(entries[0].mtime) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	fmt.Printf("    files whose different modification times will become equal: %d groups\n", len(keys))
+	for _, key := range keys {
+		for _, entry := range rounded[key] {
+			fmt.Printf("        %s  %s\n", entry.mtime.Format("2006-01-02 15:04:05.000000000"), entry.path)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// allowance for clock skew between machines
+	futureTimeSlack = time.Minute
+	// further ahead than this can't be a skewed clock
+	impossibleFutureTime = 365 * 24 * time.Hour
+)
+
+// formatAge describes a duration in the largest sensible unit.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 365*24*time.Hour:
+		return fmt.Sprintf("%.1f years", d.Hours()/(365*24))
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%.1f days", d.Hours()/24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%.1f hours", d.Hours())
+	}
+	return fmt.Sprintf("%.0f minutes", d.Minutes())
+}
+
+type timestampField struct {
+	field string
+	t     time.Time
+}
+
+// checkFutureTimes flags modification and creation times after now, which
+// come from bad clocks during past copies and confuse incremental backups.
+// counts tallies each problem and timestamp field.
+func checkFutureTimes(info os.FileInfo, now time.Time, counts map[string]int) (logs, warns []string) {
+	times := []timestampField{{"modification time", info.ModTime()}}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		times = append(times, timestampField{"creation time", time.Unix(stat.Birthtimespec.Sec, stat.Birthtimespec.Nsec)})
+	}
+	for _, ts := range times {
+		ahead := ts.t.Sub(now)
+		if ahead <= futureTimeSlack {
+			continue
+		}
+		counts["future "+ts.field]++
+		if ahead > impossibleFutureTime {
+			warns = append(warns, fmt.Sprintf("Impossible future %s (%s, %s ahead); incremental backup and sync tools will misjudge it.", ts.field, ts.t.Format(time.RFC3339), formatAge(ahead)))
+		} else {
+			warns = append(warns, fmt.Sprintf("Future %s (%s, %s ahead); incremental backup and sync tools will misjudge it.", ts.field, ts.t.Format(time.RFC3339), formatAge(ahead)))
+		}
+	}
+	return logs, warns
+}
+
+// The earliest time zip archives and FAT filesystems can store.
+var dosEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// checkOldTimes flags modification times at or before the Unix epoch, which
+// usually mean a date was lost, and before 1980, which zip and FAT can't
+// store and clamp or corrupt.
+func checkOldTimes(info os.FileInfo, counts map[string]int) (logs, warns []string) {
+	mtime := info.ModTime()
+	switch {
+	case mtime.Unix() == 0:
+		counts["epoch modification time"]++
+		warns = append(warns, "Modification time is the Unix epoch (1970-01-01); the original date was probably lost in an earlier copy.")
+	case mtime.Unix() < 0:
+		counts["pre-1970 modification time"]++
+		warns = append(warns, fmt.Sprintf("Modification time before 1970 (%s); many tools and targets can't store it.", mtime.UTC().Format(time.RFC3339)))
+	case mtime.Before(dosEpoch):
+		counts["pre-1980 modification time"]++
+		warns = append(warns, fmt.Sprintf("Modification time before 1980 (%s); zip archives and FAT/exFAT can't store it.", mtime.UTC().Format(time.RFC3339)))
+	}
+	return logs, warns
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type topFile struct {
+	path  string
+	size  int64
+	mtime time.Time
+}
+
+// topFiles keeps the n largest and n oldest files seen, for storage and
+// format-obsolescence review.
+type topFiles struct {
+	n       int
+	largest []topFile
+	oldest  []topFile
+}
+
+// keep sorts files by less and drops all but the first n once the slice
+// has grown well past n, so adding stays cheap.
+func (t *topFiles) keep(files []topFile, less func(a, b topFile) bool, force bool) []topFile {
+	if len(files) < 4*t.n && !force {
+		return files
+	}
+	sort.Slice(files, func(i, j int) bool { return less(files[i], files[j]) })
+	if len(files) > t.n {
+		files = files[:t.n]
+	}
+	return files
+}
+
+func largerFile(a, b topFile) bool { return a.size > b.size }
+
+func olderFile(a, b topFile) bool { return a.mtime.Before(b.mtime) }
+
+func (t *topFiles) add(path string, size int64, mtime time.Time) {
+	file := topFile{path, size, mtime}
+	t.largest = t.keep(append(t.largest, file), largerFile, false)
+	t.oldest = t.keep(append(t.oldest, file), olderFile, false)
+}
+
+func (t *topFiles) print() {
+	t.largest = t.keep(t.largest, largerFile, true)
+	t.oldest = t.keep(t.oldest, olderFile, true)
+	fmt.Printf("\nLargest %d files:\n", len(t.largest))
+	for _, file := range t.largest {
+		fmt.Printf("    %10s  %s\n", formatBytes(file.size), file.path)
+	}
+	fmt.Printf("\nOldest %d files (by modification time):\n", len(t.oldest))
+	for _, file := range t.oldest {
+		fmt.Printf("    %s  %s\n", file.mtime.Format("2006-01-02"), file.path)
+	}
+}
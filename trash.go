@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// Per-volume trash (.Trashes/<uid>) and per-user home trash (~/.Trash)
+const volumeTrashDir = ".Trashes"
+const userTrashDir = ".Trash"
+
+func isTrashDir(path string, info os.FileInfo) bool {
+	if info == nil || !info.IsDir() {
+		return false
+	}
+	base := filepath.Base(path)
+	return base == volumeTrashDir || base == userTrashDir
+}
+
+func userNameForUID(uid string) string {
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username
+	}
+	return "uid " + uid
+}
+
+// tallyTrash adds the contents of a trash directory to report, keyed by the
+// user the trash belongs to.
+func tallyTrash(path string, info os.FileInfo, report map[string]*fileTally) {
+	add := func(owner, dir string) {
+		size, files := dirSize(dir)
+		if report[owner] == nil {
+			report[owner] = &fileTally{}
+		}
+		report[owner].count += files
+		report[owner].size += size
+	}
+
+	if filepath.Base(path) == userTrashDir {
+		owner := "unknown"
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			owner = userNameForUID(strconv.Itoa(int(stat.Uid)))
+		}
+		add(owner, path)
+		return
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		fmt.Println(path)
+		log(err.Error(), "error")
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			add(userNameForUID(entry.Name()), filepath.Join(path, entry.Name()))
+		}
+	}
+}
+
+func printTrashReport(report map[string]*fileTally) {
+	fmt.Println("\nTrash contents by user:")
+	if len(report) == 0 {
+		fmt.Println("    (none)")
+		return
+	}
+	owners := make([]string, 0, len(report))
+	for owner := range report {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		fmt.Printf("    %s: %d files, %s\n", owner, report[owner].count, formatBytes(report[owner].size))
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// scanSummary is the per-scan record kept in the history file for trends.
+type scanSummary struct {
+	Root              string         `json:"root"`
+	Started           time.Time      `json:"started"`
+	Files             int            `json:"files"`
+	Dirs              int            `json:"dirs"`
+	Errors            int            `json:"errors"`
+	ResourceForkBytes int64          `json:"resourceForkBytes"`
+	Rules             map[string]int `json:"rules"`
+	Extensions        map[string]int `json:"extensions"`
+}
+
+func defaultHistoryPath() string {
+	usr, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(usr.HomeDir, ".weirdfs", "history.jsonl")
+}
+
+func summarizeReport(report *scanReport) scanSummary {
+	summary := scanSummary{
+		Root:              report.Root,
+		Started:           report.Started,
+		Files:             report.Files,
+		Dirs:              report.Dirs,
+		Errors:            report.Errors,
+		ResourceForkBytes: report.ResourceForkBytes,
+		Rules:             map[string]int{},
+		Extensions:        map[string]int{},
+	}
+	for _, entry := range report.Entries {
+		if !entry.Dir {
+			summary.Extensions[strictFileExtension(entry.Path)]++
+		}
+		for _, msg := range entry.findings() {
+			summary.Rules[findingRule(msg)]++
+		}
+	}
+	return summary
+}
+
+func (s scanSummary) findings() int {
+	total := 0
+	for _, count := range s.Rules {
+		total += count
+	}
+	return total
+}
+
+// appendHistory adds a summary of report to the history file, one JSON
+// object per line.
+func appendHistory(path string, report *scanReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(summarizeReport(report))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func readHistory(path string) ([]scanSummary, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// nothing recorded yet
+		return []scanSummary{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	summaries := []scanSummary{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var summary scanSummary
+		if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, scanner.Err()
+}
+
+func printTrend(summaries []scanSummary) {
+	fmt.Printf("\n%s (%d scans)\n", summaries[0].Root, len(summaries))
+	fmt.Printf("    %-16s  %10s  %10s  %10s  %12s\n", "scanned", "files", "errors", "findings", "fork bytes")
+	for _, s := range summaries {
+		fmt.Printf("    %-16s  %10d  %10d  %10d  %12s\n",
+			s.Started.Local().Format("2006-01-02 15:04"), s.Files, s.Errors, s.findings(), formatBytes(s.ResourceForkBytes))
+	}
+	if len(summaries) < 2 {
+		return
+	}
+	first, last := summaries[0], summaries[len(summaries)-1]
+	rules := map[string]int{}
+	for rule := range first.Rules {
+		rules[rule] = 0
+	}
+	for rule := range last.Rules {
+		rules[rule] = 0
+	}
+	fmt.Println("\n    Findings by rule, first scan -> latest:")
+	for _, rule := range sortedKeys(rules) {
+		before, after := first.Rules[rule], last.Rules[rule]
+		fmt.Printf("        %s: %d -> %d (%+d)\n", rule, before, after, after-before)
+	}
+	exts := map[string]int{}
+	for ext, count := range last.Extensions {
+		if delta := count - first.Extensions[ext]; delta != 0 {
+			exts[ext] = delta
+		}
+	}
+	for ext, count := range first.Extensions {
+		if _, ok := last.Extensions[ext]; !ok {
+			exts[ext] = -count
+		}
+	}
+	if len(exts) > 0 {
+		fmt.Println("\n    Extension census changes:")
+		for _, ext := range sortedKeys(exts) {
+			name := ext
+			if name == "" {
+				name = "(no extension)"
+			}
+			fmt.Printf("        %s: %d -> %d (%+d)\n", name, first.Extensions[ext], last.Extensions[ext], exts[ext])
+		}
+	}
+}
+
+func trendsCommand(args []string) {
+	flags := flag.NewFlagSet("trends", flag.ExitOnError)
+	historyPath := flags.String("history", defaultHistoryPath(), "History file that scans append their summaries to")
+	flags.Parse(args)
+
+	summaries, err := readHistory(*historyPath)
+	check(err)
+	roots := map[string][]scanSummary{}
+	for _, s := range summaries {
+		roots[s.Root] = append(roots[s.Root], s)
+	}
+	filter := ""
+	if flags.NArg() > 0 {
+		filter = scanRoot(flags.Arg(0))
+	}
+	names := make([]string, 0, len(roots))
+	for root := range roots {
+		if filter == "" || root == filter {
+			names = append(names, root)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Println("No scans recorded.")
+		return
+	}
+	for _, root := range names {
+		scans := roots[root]
+		sort.Slice(scans, func(i, j int) bool { return scans[i].Started.Before(scans[j].Started) })
+		printTrend(scans)
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/xattr"
+)
+
+// browserNode is a file or directory in the results browser. Directories are
+// synthesized from the paths of entries with findings.
+type browserNode struct {
+	name     string
+	rel      string
+	dir      bool
+	entry    *reportEntry
+	children map[string]*browserNode
+	parent   *browserNode
+}
+
+// resultsBrowser is a full-screen terminal UI over a scan report.
+type resultsBrowser struct {
+	report  *scanReport
+	root    *browserNode
+	current *browserNode
+	cursor  int
+	// the rule findings are filtered by, and the report's rules to pick from
+	filter string
+	rules  ruleSummary
+	// findings below each node matching the filter, recounted when it changes
+	counts  map[*browserNode]int
+	marked  map[string]bool
+	message string
+	in      *bufio.Reader
+}
+
+func newBrowserNode(name, rel string, parent *browserNode) *browserNode {
+	return &browserNode{name: name, rel: rel, dir: true, children: map[string]*browserNode{}, parent: parent}
+}
+
+func buildBrowserTree(report *scanReport) *browserNode {
+	root := newBrowserNode(report.Root, ".", nil)
+	for i := range report.Entries {
+		entry := &report.Entries[i]
+		if len(entry.findings()) == 0 || entry.Path == "." {
+			continue
+		}
+		node := root
+		parts := strings.Split(entry.Path, string(filepath.Separator))
+		for j, part := range parts {
+			child, ok := node.children[part]
+			if !ok {
+				child = newBrowserNode(part, strings.Join(parts[:j+1], string(filepath.Separator)), node)
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.entry = entry
+		node.dir = entry.Dir || len(node.children) > 0
+	}
+	return root
+}
+
+func (b *resultsBrowser) matches(finding string) bool {
+	return b.filter == "" || findingRule(finding) == b.filter
+}
+
+// countFindings counts the findings below node that match the filter,
+// caching the count of node and each node below it.
+func (b *resultsBrowser) countFindings(node *browserNode) int {
+	count := 0
+	if node.entry != nil {
+		for _, finding := range node.entry.findings() {
+			if b.matches(finding) {
+				count++
+			}
+		}
+	}
+	for _, child := range node.children {
+		count += b.countFindings(child)
+	}
+	b.counts[node] = count
+	return count
+}
+
+func (b *resultsBrowser) findingCount(node *browserNode) int {
+	return b.counts[node]
+}
+
+// setFilter filters the findings by rule ("" for all of them).
+func (b *resultsBrowser) setFilter(rule string) {
+	b.filter = rule
+	b.counts = map[*browserNode]int{}
+	b.countFindings(b.root)
+	b.cursor = 0
+}
+
+// pickRule lists the report's rules, most findings first, and returns the one
+// chosen by number, "" to show every finding, or the current filter if
+// cancelled with escape.
+func (b *resultsBrowser) pickRule() string {
+	rules := b.rules.rules()
+	answer := ""
+	for {
+		width, height, ok := terminalSize()
+		if !ok {
+			width, height = 80, 24
+		}
+		var out strings.Builder
+		out.WriteString("\x1b[H\x1b[2J\x1b[1mFilter by rule\x1b[0m\r\n")
+		for i, rule := range rules {
+			if i == height-3 {
+				break
+			}
+			out.WriteString(truncate(fmt.Sprintf("%4d %7d  %s", i+1, b.rules[rule].count, rule), width) + "\r\n")
+		}
+		out.WriteString("Rule number (blank for all findings): " + answer + "_")
+		fmt.Print(out.String())
+		switch key := b.readKey(); key {
+		case "\r", "\n":
+			var n int
+			if _, err := fmt.Sscanf(answer, "%d", &n); err != nil || n < 1 || n > len(rules) {
+				return ""
+			}
+			return rules[n-1]
+		case "esc":
+			return b.filter
+		case "\x7f", "\b":
+			if len(answer) > 0 {
+				answer = answer[:len(answer)-1]
+			}
+		default:
+			if len(key) == 1 && key[0] >= '0' && key[0] <= '9' {
+				answer += key
+			}
+		}
+	}
+}
+
+func (b *resultsBrowser) visibleChildren() []*browserNode {
+	children := []*browserNode{}
+	for _, child := range b.current.children {
+		if b.findingCount(child) > 0 {
+			children = append(children, child)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	return children
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return s
+}
+
+func (b *resultsBrowser) render() {
+	width, height, ok := terminalSize()
+	if !ok {
+		width, height = 80, 24
+	}
+	children := b.visibleChildren()
+	if b.cursor >= len(children) {
+		b.cursor = len(children) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J")
+	header := fmt.Sprintf("weirdfs: %s", filepath.Join(b.report.Root, b.current.rel))
+	if b.filter != "" {
+		header += fmt.Sprintf("  [filter: %s]", b.filter)
+	}
+	out.WriteString("\x1b[1m" + truncate(header, width) + "\x1b[0m\r\n")
+
+	rows := height - 3
+	start := 0
+	if b.cursor >= rows {
+		start = b.cursor - rows + 1
+	}
+	for i := start; i < len(children) && i < start+rows; i++ {
+		child := children[i]
+		mark := " "
+		if b.marked[child.rel] {
+			mark = "*"
+		}
+		name := child.name
+		if child.dir {
+			name += "/"
+		}
+		line := fmt.Sprintf("%s %-6d %s", mark, b.findingCount(child), name)
+		if i == b.cursor {
+			out.WriteString("\x1b[7m" + truncate(line, width) + "\x1b[0m\r\n")
+		} else {
+			out.WriteString(truncate(line, width) + "\r\n")
+		}
+	}
+	for i := len(children) - start; i < rows; i++ {
+		out.WriteString("\r\n")
+	}
+	status := "↑/↓ move  →/enter open  ← up  p preview  / filter by rule  space mark  w write plan  q quit"
+	if b.message != "" {
+		status = b.message
+	}
+	out.WriteString("\x1b[7m" + truncate(fmt.Sprintf("%-*s", width, status), width) + "\x1b[0m")
+	fmt.Print(out.String())
+}
+
+// renderPreview shows the findings, xattrs, and resource types of a node.
+func (b *resultsBrowser) renderPreview(node *browserNode) {
+	path := filepath.Join(b.report.Root, node.rel)
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J\x1b[1m" + path + "\x1b[0m\r\n\r\n")
+	if node.entry != nil {
+		for _, msg := range node.entry.Errors {
+			out.WriteString("    [ERROR] " + msg + "\r\n")
+		}
+		for _, msg := range node.entry.Warnings {
+			out.WriteString("    [WARN] " + msg + "\r\n")
+		}
+		for _, msg := range node.entry.Info {
+			out.WriteString("    [INFO] " + msg + "\r\n")
+		}
+	}
+	out.WriteString("\r\n")
+	if attrs, err := xattr.List(path); err != nil {
+		out.WriteString("    xattrs: " + err.Error() + "\r\n")
+	} else {
+		for _, attr := range attrs {
+			value, _ := xattr.Get(path, attr)
+			out.WriteString(fmt.Sprintf("    %s (%s)\r\n", attr, formatBytes(int64(len(value)))))
+			if attr == "com.apple.ResourceFork" {
+				if types, err := extractResourceTypes(path); err == nil {
+					out.WriteString("        resource types: '" + strings.Join(types, "', '") + "'\r\n")
+				}
+			}
+		}
+	}
+	out.WriteString("\r\n(press any key)")
+	fmt.Print(out.String())
+	b.readKey()
+}
+
+func (b *resultsBrowser) readKey() string {
+	c, err := b.in.ReadByte()
+	if err != nil {
+		return "q"
+	}
+	if c != 0x1b {
+		return string(c)
+	}
+	// arrow keys arrive as ESC [ A-D
+	if next, _ := b.in.Peek(1); len(next) == 1 && next[0] == '[' {
+		b.in.ReadByte()
+		c, _ = b.in.ReadByte()
+		switch c {
+		case 'A':
+			return "up"
+		case 'B':
+			return "down"
+		case 'C':
+			return "right"
+		case 'D':
+			return "left"
+		}
+	}
+	return "esc"
+}
+
+// readLine reads a line of input in raw mode, echoing it on the status line.
+func (b *resultsBrowser) readLine(label, initial string) string {
+	line := initial
+	for {
+		b.message = label + line + "_"
+		b.render()
+		key := b.readKey()
+		switch key {
+		case "\r", "\n":
+			b.message = ""
+			return line
+		case "esc":
+			b.message = ""
+			return initial
+		case "\x7f", "\b":
+			if runes := []rune(line); len(runes) > 0 {
+				line = string(runes[:len(runes)-1])
+			}
+		default:
+			if len(key) == 1 && key[0] >= 0x20 {
+				line += key
+			}
+		}
+	}
+}
+
+// writeMarkedPlan proposes the standard renames for marked paths and writes
+// them as a plan for review with 'weirdfs apply'.
+func (b *resultsBrowser) writeMarkedPlan(output string) (int, error) {
+	rules := []renameRule{
+		renameIllegalChars(parseSubstitutions(defaultSubstitutions())),
+		trimTrailingChars,
+		addMissingExtensions(defaultTypeCodeExtensions),
+	}
+	paths := []string{}
+	for rel := range b.marked {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	actions := []fixAction{}
+	taken := map[string]bool{}
+	for _, rel := range paths {
+		path := filepath.Join(b.report.Root, rel)
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if action := proposeRename(path, info, rules, taken); action != nil {
+			actions = append(actions, *action)
+		}
+	}
+	reverseActions(actions)
+	return len(actions), writePlan(actions, output, "csv")
+}
+
+func (b *resultsBrowser) run() {
+	for {
+		b.render()
+		b.message = ""
+		children := b.visibleChildren()
+		var selected *browserNode
+		if b.cursor < len(children) {
+			selected = children[b.cursor]
+		}
+		switch b.readKey() {
+		case "q", "\x03":
+			return
+		case "up", "k":
+			b.cursor--
+		case "down", "j":
+			b.cursor++
+		case "right", "l", "\r", "\n":
+			if selected != nil && selected.dir && len(selected.children) > 0 {
+				b.current = selected
+				b.cursor = 0
+			} else if selected != nil {
+				b.renderPreview(selected)
+			}
+		case "left", "h", "\x7f":
+			if b.current.parent != nil {
+				b.current = b.current.parent
+				b.cursor = 0
+			}
+		case "p":
+			if selected != nil {
+				b.renderPreview(selected)
+			}
+		case "/":
+			b.setFilter(b.pickRule())
+		case " ":
+			if selected != nil {
+				b.marked[selected.rel] = !b.marked[selected.rel]
+				if !b.marked[selected.rel] {
+					delete(b.marked, selected.rel)
+				}
+				b.cursor++
+			}
+		case "w":
+			output := b.readLine("Write plan for marked items to: ", "weirdfs-plan.csv")
+			count, err := b.writeMarkedPlan(output)
+			if err != nil {
+				b.message = err.Error()
+			} else {
+				b.message = fmt.Sprintf("Wrote %d fixes for %d marked items to %s", count, len(b.marked), output)
+			}
+		}
+	}
+}
+
+func termios(fd uintptr, request uintptr, t *syscall.Termios) error {
+	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(t)), 0, 0, 0); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// browseReport opens the results browser, putting the terminal in raw mode
+// for the duration.
+func browseReport(report *scanReport) {
+	var saved syscall.Termios
+	if err := termios(uintptr(syscall.Stdin), syscall.TIOCGETA, &saved); err != nil {
+		check(fmt.Errorf("the results browser needs a terminal: %s", err))
+	}
+	raw := saved
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON
+	raw.Iflag &^= syscall.ICRNL
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	check(termios(uintptr(syscall.Stdin), syscall.TIOCSETA, &raw))
+	defer termios(uintptr(syscall.Stdin), syscall.TIOCSETA, &saved)
+
+	// use the alternate screen so the scan output is still there afterwards
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	root := buildBrowserTree(report)
+	rules := ruleSummary{}
+	for _, entry := range report.Entries {
+		rules.add(entry.Errors, entry.Warnings, entry.Size)
+	}
+	browser := &resultsBrowser{
+		report:  report,
+		root:    root,
+		current: root,
+		rules:   rules,
+		marked:  map[string]bool{},
+		in:      bufio.NewReader(os.Stdin),
+	}
+	browser.setFilter("")
+	browser.run()
+}
+
+func browseCommand(args []string) {
+	flags := flag.NewFlagSet("browse", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs browse <report.json>")
+		os.Exit(2)
+	}
+	browseReport(readScanReport(flags.Arg(0)))
+}
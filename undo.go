@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+const (
+	journalQuarantine = "quarantine"
+	journalSetXattrs  = "set-xattrs"
+)
+
+// Directory (under the cleaned root) where clean moves junk so it can be
+// restored by undo
+const quarantineDirName = ".weirdfs-quarantine"
+
+// journalEntry records one change made by fix, apply, clean, or a scan.
+// Stripped or overwritten xattr values are stored inline so undo doesn't
+// depend on a separate backup; Added lists xattrs that didn't exist before.
+type journalEntry struct {
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`
+	Path    string            `json:"path"`
+	NewPath string            `json:"newPath,omitempty"`
+	Xattrs  map[string][]byte `json:"xattrs,omitempty"`
+	Added   []string          `json:"added,omitempty"`
+}
+
+// undoJournal appends entries as JSON lines so a partially completed run can
+// still be undone.
+type undoJournal struct {
+	path string
+	f    *os.File
+}
+
+func defaultJournalPath() string {
+	return fmt.Sprintf("weirdfs-undo-%s.jsonl", time.Now().Format("20060102-150405"))
+}
+
+func openUndoJournal(path string) *undoJournal {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	check(err)
+	return &undoJournal{path: path, f: f}
+}
+
+func (j *undoJournal) record(entry journalEntry) error {
+	entry.Time = time.Now().UTC()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+func (j *undoJournal) close() {
+	j.f.Close()
+	fmt.Printf("Undo journal: %s (revert with 'weirdfs undo %s')\n", j.path, j.path)
+}
+
+// applyFixActionJournaled applies a fix and records how to revert it.
+func applyFixActionJournaled(action fixAction, journal *undoJournal) error {
+	entry := journalEntry{Action: action.kind, Path: action.path, NewPath: action.newPath}
+	if action.kind == fixStripXattr {
+		entry.Xattrs = map[string][]byte{}
+		for _, name := range action.xattrs {
+			value, err := xattr.Get(action.path, name)
+			if err != nil {
+				return err
+			}
+			entry.Xattrs[name] = value
+		}
+	}
+	if err := applyFixAction(action); err != nil {
+		return err
+	}
+	return journal.record(entry)
+}
+
+// quarantinePath moves path into the quarantine area under root, preserving
+// its relative location, and returns the new location. With a journal, the
+// move is recorded before it is made, so a crash in between can't leave a
+// quarantined item undo doesn't know about.
+func quarantinePath(root, quarantine, path string, journal *undoJournal) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(quarantine, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	dest = filepath.Join(filepath.Dir(dest), uniqueName(filepath.Dir(dest), filepath.Base(dest), path, map[string]bool{}))
+	if journal != nil {
+		if err := journal.record(journalEntry{Action: journalQuarantine, Path: path, NewPath: dest}); err != nil {
+			return "", err
+		}
+	}
+	return dest, os.Rename(path, dest)
+}
+
+// undoContext journals the changes a scan makes (junk removal, AppleDouble
+// merges, clearing quarantine) and moves what it removes into the
+// quarantine area, so 'weirdfs undo' can revert them.
+type undoContext struct {
+	root       string
+	quarantine string
+	journal    *undoJournal
+}
+
+func newUndoContext(root, journalPath string) *undoContext {
+	if journalPath == "" {
+		journalPath = defaultJournalPath()
+	}
+	return &undoContext{root: root, quarantine: filepath.Join(root, quarantineDirName), journal: openUndoJournal(journalPath)}
+}
+
+// remove moves path into the quarantine area.
+func (u *undoContext) remove(path string) error {
+	_, err := quarantinePath(u.root, u.quarantine, path, u.journal)
+	return err
+}
+
+// setXattrs sets xattrs on path, first recording the values they replace.
+// The entry is written before any are set so a partial failure can still be
+// undone.
+func (u *undoContext) setXattrs(path string, values map[string][]byte) error {
+	existing, err := xattr.List(path)
+	if err != nil {
+		return err
+	}
+	entry := journalEntry{Action: journalSetXattrs, Path: path, Xattrs: map[string][]byte{}}
+	for name := range values {
+		if !containsString(existing, name) {
+			entry.Added = append(entry.Added, name)
+			continue
+		}
+		value, err := xattr.Get(path, name)
+		if err != nil {
+			return err
+		}
+		entry.Xattrs[name] = value
+	}
+	if err := u.journal.record(entry); err != nil {
+		return err
+	}
+	for name, value := range values {
+		if err := xattr.Set(path, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeXattr removes an xattr, recording its value.
+func (u *undoContext) removeXattr(path, name string) error {
+	value, err := xattr.Get(path, name)
+	if err != nil {
+		return err
+	}
+	if err := u.journal.record(journalEntry{Action: fixStripXattr, Path: path, Xattrs: map[string][]byte{name: value}}); err != nil {
+		return err
+	}
+	return xattr.Remove(path, name)
+}
+
+func readJournal(path string) []journalEntry {
+	f, err := os.Open(path)
+	check(err)
+	defer f.Close()
+	entries := []journalEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		check(json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	check(scanner.Err())
+	return entries
+}
+
+func undoEntry(entry journalEntry) error {
+	switch entry.Action {
+	case fixRename, journalQuarantine:
+		if _, err := os.Lstat(entry.Path); err == nil && !isSameEntry(entry.Path, entry.NewPath) {
+			return fmt.Errorf("%s already exists", entry.Path)
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+			return err
+		}
+		return os.Rename(entry.NewPath, entry.Path)
+	case fixUnlock:
+		return setLocked(entry.Path, true)
+	case fixUnhide:
+		return setFileFlag(entry.Path, ufHidden, true)
+	case fixMakeVisible:
+		return setFinderFlag(entry.Path, finderFlagIsInvisible, true)
+	case fixStripXattr:
+		for name, value := range entry.Xattrs {
+			if err := xattr.Set(entry.Path, name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case journalSetXattrs:
+		for name, value := range entry.Xattrs {
+			if err := xattr.Set(entry.Path, name, value); err != nil {
+				return err
+			}
+		}
+		for _, name := range entry.Added {
+			// a partially applied merge may not have set it
+			if err := xattr.Remove(entry.Path, name); err != nil && !isNoAttr(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown journal action '%s'", entry.Action)
+}
+
+func isNoAttr(err error) bool {
+	xerr, ok := err.(*xattr.Error)
+	return ok && xerr.Err == xattr.ENOATTR
+}
+
+func undoCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs undo <journal>")
+		os.Exit(2)
+	}
+	entries := readJournal(args[0])
+	reverted, failures := 0, 0
+	// revert in reverse order so renamed parents are restored after children
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if err := undoEntry(entry); err != nil {
+			fmt.Println(entry.Path)
+			log(fmt.Sprintf("Could not undo %s: %s", entry.Action, err), "error")
+			failures++
+			continue
+		}
+		fmt.Printf("Reverted %s of %s\n", entry.Action, entry.Path)
+		reverted++
+	}
+	fmt.Printf("\nReverted %d of %d journal entries. %d failures.\n", reverted, len(entries), failures)
+}
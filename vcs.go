@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Metadata directories that mark a version control checkout
+var vcsMetadataDirs = map[string]string{
+	".git": "git",
+	".svn": "svn",
+	".hg":  "hg",
+	".bzr": "bzr",
+}
+
+type vcsRepo struct {
+	path         string
+	kind         string
+	metadataSize int64
+	checkoutSize int64
+}
+
+// detectVCSRepo returns a repository record if path is a VCS metadata
+// directory.
+func detectVCSRepo(path string, info os.FileInfo) *vcsRepo {
+	if info == nil || !info.IsDir() {
+		return nil
+	}
+	kind, ok := vcsMetadataDirs[filepath.Base(path)]
+	if !ok {
+		return nil
+	}
+	metadataSize, _ := dirSize(path)
+	checkoutSize, _ := dirSize(filepath.Dir(path))
+	return &vcsRepo{
+		path:         filepath.Dir(path),
+		kind:         kind,
+		metadataSize: metadataSize,
+		checkoutSize: checkoutSize,
+	}
+}
+
+func printVCSRepos(repos []vcsRepo) {
+	fmt.Printf("\nVersion control checkouts: %d\n", len(repos))
+	for _, repo := range repos {
+		fmt.Printf("    %s (%s, %s total, %s of repository metadata)\n", repo.path, repo.kind, formatBytes(repo.checkoutSize), formatBytes(repo.metadataSize))
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// destResolver finds the destination counterpart of a source path, tolerating
+// names that differ only in ways fold erases (e.g. Unicode normalization).
+// Names are matched against directory listings rather than looked up, since
+// APFS and HFS+ lookups already ignore normalization (and usually case) and
+// would hide the difference.
+type destResolver struct {
+	root     string
+	fold     func(string) string
+	listings map[string]map[string]string
+	names    map[string]map[string]bool
+}
+
+func newDestResolver(root string, fold func(string) string) *destResolver {
+	return &destResolver{root: root, fold: fold, listings: map[string]map[string]string{}, names: map[string]map[string]bool{}}
+}
+
+// foldNFC treats names as equal if they differ only by Unicode normalization.
+func foldNFC(name string) string {
+	return norm.NFC.String(name)
+}
+
+// foldCaseNFC treats names as equal the way a case-insensitive,
+// normalization-insensitive filesystem (APFS, HFS+, SMB) does.
+func foldCaseNFC(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// normalizedNames maps the folded form of each name in dir to the name on disk.
+func (r *destResolver) normalizedNames(dir string) map[string]string {
+	if names, ok := r.listings[dir]; ok {
+		return names
+	}
+	names := map[string]string{}
+	exact := map[string]bool{}
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		names[r.fold(entry.Name())] = entry.Name()
+		exact[entry.Name()] = true
+	}
+	r.listings[dir] = names
+	r.names[dir] = exact
+	return names
+}
+
+// resolve returns the destination path for rel and whether any component's
+// name on disk differs byte-for-byte from the one in rel.
+func (r *destResolver) resolve(rel string) (path string, renormalized bool, err error) {
+	path = r.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		folded := r.normalizedNames(path)
+		if r.names[path][part] {
+			path = filepath.Join(path, part)
+			continue
+		}
+		actual, ok := folded[r.fold(part)]
+		if !ok {
+			return "", false, os.ErrNotExist
+		}
+		path = filepath.Join(path, actual)
+		renormalized = true
+	}
+	return path, renormalized, nil
+}
+
+// fidelityReport counts differences found by verify, by kind.
+type fidelityReport map[string]int
+
+func (r fidelityReport) add(kind string, path string, msg string, level string) {
+	r[kind]++
+	printStatusLine("")
+	fmt.Println(path)
+	log(msg, level)
+}
+
+func compareTrees(source, dest string) fidelityReport {
+	report := fidelityReport{}
+	resolver := newDestResolver(dest, foldNFC)
+	checked := 0
+
+	err := walkScannable(source, func(path string, info os.FileInfo) error {
+		rel, err := filepath.Rel(source, path)
+		check(err)
+		checked++
+		printStatusLine(fmt.Sprintf("%d: %s", checked, path))
+
+		destPath, renormalized, err := resolver.resolve(rel)
+		if err != nil {
+			report.add("missing", path, "Missing from destination.", "error")
+			return nil
+		}
+		if renormalized {
+			report.add("normalization", path, fmt.Sprintf("Name normalization changed: %s", destPath), "warn")
+		}
+		destInfo, err := os.Lstat(destPath)
+		if err != nil {
+			report.add("missing", path, err.Error(), "error")
+			return nil
+		}
+
+		expected, err := buildManifestEntry(source, path, info)
+		if err != nil {
+			report.add("errors", path, err.Error(), "error")
+			return nil
+		}
+		actual, err := buildManifestEntry(dest, destPath, destInfo)
+		if err != nil {
+			report.add("errors", path, err.Error(), "error")
+			return nil
+		}
+		if expected.Dir != actual.Dir {
+			report.add("type", path, "Changed type (file vs. directory).", "error")
+			return nil
+		}
+		if expected.SHA256 != actual.SHA256 {
+			report.add("content", path, fmt.Sprintf("Data differs (%s vs. %s).", formatBytes(expected.Size), formatBytes(actual.Size)), "error")
+		}
+		if expected.ResourceForkSHA256 != "" && expected.ResourceForkSHA256 != actual.ResourceForkSHA256 {
+			if actual.ResourceForkSHA256 == "" {
+				report.add("resource forks", path, "Resource fork lost.", "error")
+			} else {
+				report.add("resource forks", path, "Resource fork differs.", "error")
+			}
+		}
+		lost := []string{}
+		for _, name := range expected.Xattrs {
+			if !containsString(actual.Xattrs, name) {
+				lost = append(lost, name)
+			}
+		}
+		if len(lost) > 0 {
+			report.add("xattrs", path, fmt.Sprintf("Lost xattrs: %s", strings.Join(lost, ", ")), "warn")
+		}
+		if !info.IsDir() && !expected.ModTime.Equal(actual.ModTime) {
+			report.add("timestamps", path, fmt.Sprintf("Modification time differs (%v vs. %v).", expected.ModTime, actual.ModTime), "warn")
+		}
+		if info.Mode().Perm() != destInfo.Mode().Perm() {
+			report.add("permissions", path, fmt.Sprintf("Permissions differ (%v vs. %v).", info.Mode().Perm(), destInfo.Mode().Perm()), "warn")
+		}
+		return nil
+	})
+	check(err)
+	printStatusLine("")
+	fmt.Printf("\nCompared %d entries.\n", checked)
+	return report
+}
+
+func printFidelityReport(report fidelityReport) {
+	if len(report) == 0 {
+		fmt.Println("No differences found.")
+		return
+	}
+	fmt.Println("Differences by kind:")
+	kinds := make([]string, 0, len(report))
+	for kind := range report {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("    %s: %d\n", kind, report[kind])
+	}
+}
+
+func verifyCommand(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs verify <source> <dest>")
+		os.Exit(2)
+	}
+	source := scanRoot(flags.Arg(0))
+	dest := scanRoot(flags.Arg(1))
+	fmt.Printf("Verifying copy of %s at %s\n", source, dest)
+
+	report := compareTrees(source, dest)
+	printFidelityReport(report)
+	if len(report) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Filesystem types of network volumes, as reported by statfs.
+var networkFilesystems = []string{"smbfs", "nfs", "afpfs", "webdav", "cifs"}
+
+// volumeBoundary is where the walk crosses into another volume.
+type volumeBoundary struct {
+	path    string
+	fsType  string
+	source  string
+	network bool
+}
+
+func cString(chars []int8) string {
+	b := make([]byte, 0, len(chars))
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
+
+func deviceOf(info os.FileInfo) (int32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return stat.Dev, true
+}
+
+// isVolumeBoundary reports whether a directory is on a different device than
+// its parent, i.e. another volume is mounted there.
+func isVolumeBoundary(path string, info os.FileInfo) bool {
+	if !info.IsDir() {
+		return false
+	}
+	parent, err := os.Lstat(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	dev, ok1 := deviceOf(info)
+	parentDev, ok2 := deviceOf(parent)
+	return ok1 && ok2 && dev != parentDev
+}
+
+// checkVolumeBoundary reports a mount point inside the scanned tree, so a
+// network share or disk image isn't audited as if it were local data.
+func checkVolumeBoundary(path string, skip bool, boundaries *[]volumeBoundary) (logs, warns []string) {
+	boundary := volumeBoundary{path: path}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		warns = append(warns, fmt.Sprintf("Error: %s", err))
+	} else {
+		boundary.fsType = cString(fs.Fstypename[:])
+		boundary.source = cString(fs.Mntfromname[:])
+		boundary.network = containsString(networkFilesystems, boundary.fsType)
+	}
+	*boundaries = append(*boundaries, boundary)
+	kind := "another volume"
+	if boundary.network {
+		kind = "a network volume"
+	}
+	action := "its contents are scanned as part of this tree"
+	if skip {
+		action = "skipped"
+	}
+	return logs, append(warns, fmt.Sprintf("Mount point of %s (%s from %s); %s.", kind, boundary.fsType, boundary.source, action))
+}
+
+func printVolumeBoundaries(boundaries []volumeBoundary) {
+	fmt.Println("\nOther volumes mounted inside the tree:")
+	for _, boundary := range boundaries {
+		network := ""
+		if boundary.network {
+			network = ", network"
+		}
+		fmt.Printf("    %s (%s from %s%s)\n", boundary.path, boundary.fsType, boundary.source, network)
+	}
+}
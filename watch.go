@@ -0,0 +1,349 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+// watchedEntry is what the watcher last saw for a path, so directory events
+// can be narrowed down to the entries that actually changed.
+type watchedEntry struct {
+	modTime time.Time
+	size    int64
+}
+
+// watcher uses kqueue vnode events on every directory under root to notice
+// files being added, renamed, or replaced, and on every file to notice them
+// being modified in place, then checks them once they have stopped changing.
+// kqueue needs an open descriptor per watched path, so a tree with more
+// entries than the file descriptor limit (which the Go runtime raises to the
+// hard limit at startup) is only partly watched; FSEvents would avoid that
+// but needs cgo.
+type watcher struct {
+	root                      string
+	kq                        int
+	dirs                      map[int]string
+	files                     map[int]string
+	fds                       map[string]int
+	outOfFDs                  bool
+	seen                      map[string]*watchedEntry
+	pending                   map[string]time.Time
+	settle                    time.Duration
+	allowTextMissingExtension bool
+	report                    func(path string, errors, warns, logs []string)
+	// afterCheck runs after each batch of settled paths has been checked
+	afterCheck func()
+}
+
+func newWatcher(root string, settle time.Duration) (*watcher, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+	return &watcher{
+		root:    root,
+		kq:      kq,
+		dirs:    map[int]string{},
+		files:   map[int]string{},
+		fds:     map[string]int{},
+		seen:    map[string]*watchedEntry{},
+		pending: map[string]time.Time{},
+		settle:  settle,
+	}, nil
+}
+
+// watchPath registers a directory or regular file with the kqueue. Once
+// file descriptors run out, that is reported once and further paths are
+// left unwatched.
+func (w *watcher) watchPath(path string, isDir bool) error {
+	if _, ok := w.fds[path]; ok || w.outOfFDs {
+		return nil
+	}
+	fd, err := syscall.Open(path, syscall.O_RDONLY, 0)
+	if err == syscall.EMFILE || err == syscall.ENFILE {
+		w.outOfFDs = true
+		return fmt.Errorf("Out of file descriptors after watching %d paths; the rest of the tree isn't watched (raise the limit with 'ulimit -n' or watch a smaller tree).", len(w.fds))
+	}
+	if err != nil {
+		return err
+	}
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	change.Fflags = syscall.NOTE_WRITE | syscall.NOTE_DELETE | syscall.NOTE_RENAME
+	if !isDir {
+		change.Fflags |= syscall.NOTE_EXTEND | syscall.NOTE_ATTRIB
+	}
+	if _, err := syscall.Kevent(w.kq, []syscall.Kevent_t{change}, nil, nil); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	if isDir {
+		w.dirs[fd] = path
+	} else {
+		w.files[fd] = path
+	}
+	w.fds[path] = fd
+	return nil
+}
+
+func (w *watcher) unwatch(path string) {
+	if fd, ok := w.fds[path]; ok {
+		syscall.Close(fd)
+		delete(w.dirs, fd)
+		delete(w.files, fd)
+		delete(w.fds, path)
+	}
+}
+
+// addTree watches dir and everything below it. Existing entries are recorded
+// as already seen unless checkExisting is set.
+func (w *watcher) addTree(dir string, checkExisting bool) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || isIgnoredPath(path) {
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || info.Mode().IsRegular() {
+			if err := w.watchPath(path, info.IsDir()); err != nil {
+				w.report(path, []string{err.Error()}, []string{}, []string{})
+			}
+		}
+		w.seen[path] = &watchedEntry{modTime: info.ModTime(), size: info.Size()}
+		if checkExisting {
+			w.pending[path] = time.Now()
+		}
+		return nil
+	})
+}
+
+// rescanDir compares the entries of dir with what was last seen and queues
+// anything new or modified for checking.
+func (w *watcher) rescanDir(dir string) {
+	names, err := readDirNames(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			w.unwatch(dir)
+		}
+		return
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if isIgnoredFile(name) || isIgnoredPath(path) {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		last, ok := w.seen[path]
+		if ok && last.modTime.Equal(info.ModTime()) && last.size == info.Size() {
+			continue
+		}
+		if info.IsDir() && !ok {
+			w.addTree(path, true)
+			continue
+		}
+		if info.Mode().IsRegular() {
+			if err := w.watchPath(path, false); err != nil {
+				w.report(path, []string{err.Error()}, []string{}, []string{})
+			}
+		}
+		w.seen[path] = &watchedEntry{modTime: info.ModTime(), size: info.Size()}
+		w.pending[path] = time.Now()
+	}
+}
+
+// fileChanged queues a watched file that was modified in place.
+func (w *watcher) fileChanged(path string) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		w.unwatch(path)
+		return
+	}
+	w.seen[path] = &watchedEntry{modTime: info.ModTime(), size: info.Size()}
+	w.pending[path] = time.Now()
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// checkSettled checks pending paths that have not changed for the settle
+// period, so files still being copied in are not reported half-written.
+func (w *watcher) checkSettled() {
+	now := time.Now()
+	for path, queued := range w.pending {
+		if now.Sub(queued) < w.settle {
+			continue
+		}
+		delete(w.pending, path)
+		info, err := os.Lstat(path)
+		if err != nil {
+			delete(w.seen, path)
+			continue
+		}
+		last := w.seen[path]
+		if last != nil && (!last.modTime.Equal(info.ModTime()) || last.size != info.Size()) {
+			// still being written; look again after another settle period
+			w.seen[path] = &watchedEntry{modTime: info.ModTime(), size: info.Size()}
+			w.pending[path] = now
+			continue
+		}
+		w.seen[path] = &watchedEntry{modTime: info.ModTime(), size: info.Size()}
+		errors, warns, logs := watchCheck(path, info, w.allowTextMissingExtension)
+		w.report(path, errors, warns, logs)
+	}
+}
+
+// watchCheck runs the per-file scan checks that apply to a single new or
+// modified path.
+func watchCheck(path string, info os.FileInfo, allowTextMissingExtension bool) (errors, warns, logs []string) {
+	errors = []string{}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return errors, []string{}, []string{}
+	}
+	if category := matchJunk(path, info); category != nil {
+		logs, warns, _ := checkJunk(path, info, category)
+		return errors, warns, logs
+	}
+	if info.Mode().IsRegular() && isAppleDoubleName(filepath.Base(path)) {
+		logs, warns, _ := checkAppleDouble(path, info, nil)
+		return errors, warns, logs
+	}
+	logs, warns = checkBasename(path, info, allowTextMissingExtension)
+	if info.Mode().IsRegular() {
+		logs2, warns2 := checkSyncConflict(path, info, &syncConflictReport{kinds: map[string]*fileTally{}})
+		logs = append(logs, logs2...)
+		warns = append(warns, warns2...)
+	}
+	xattrNames, err := xattr.List(path)
+	if err != nil {
+		errors = append(errors, err.Error())
+	}
+	allXattrNames := xattrNames
+	xattrNames = removeIgnoredXattrs(xattrNames)
+	logs2, warns2 := evaluateXattrs(path, info, xattrNames, &map[string]int{}, &map[string][]string{}, new(int64))
+	logs = append(logs, logs2...)
+	warns = append(warns, warns2...)
+	logs2, warns2, _ = checkFinderTags(path, xattrNames)
+	logs = append(logs, logs2...)
+	warns = append(warns, warns2...)
+	logs2, warns2 = checkLocked(path, info, allXattrNames)
+	logs = append(logs, logs2...)
+	warns = append(warns, warns2...)
+	return errors, warns, logs
+}
+
+func (w *watcher) run() error {
+	events := make([]syscall.Kevent_t, 32)
+	timeout := syscall.NsecToTimespec(int64(w.settle))
+	for {
+		n, err := syscall.Kevent(w.kq, nil, events, &timeout)
+		if err == syscall.EINTR || (err == nil && n < 0) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, event := range events[:n] {
+			if file, ok := w.files[int(event.Ident)]; ok {
+				if event.Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME) != 0 {
+					// the directory event queues any replacement, but it may
+					// have come first, so watch the new file here
+					w.unwatch(file)
+					if info, err := os.Lstat(file); err == nil && info.Mode().IsRegular() {
+						w.watchPath(file, false)
+					}
+					continue
+				}
+				w.fileChanged(file)
+				continue
+			}
+			dir, ok := w.dirs[int(event.Ident)]
+			if !ok {
+				continue
+			}
+			if event.Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME) != 0 {
+				w.unwatch(dir)
+				continue
+			}
+			w.rescanDir(dir)
+		}
+		w.checkSettled()
+		if w.afterCheck != nil {
+			w.afterCheck()
+		}
+	}
+}
+
+func watchCommand(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	debug := flags.Bool("debug", false, "Output extra debugging info")
+	settle := flags.Duration("settle", 2*time.Second, "How long a file must stay unchanged before it is checked")
+	checkExisting := flags.Bool("checkExisting", false, "Check files already in the directory when watching starts")
+	allowTextMissingExtension := flags.Bool("allowTextMissingExtension", false, "Allow plain text files without file extension")
+	logPath := flags.String("log", "", "Also append findings to this file")
+	metricsAddr := flags.String("metrics", "", "Serve Prometheus metrics on /metrics at this address, e.g. ':9410'")
+	notify := addNotifyFlags(flags)
+	sysLog := addSyslogFlags(flags)
+	flags.Parse(args)
+	notify.checkLevel()
+	dir := scanRoot(flags.Arg(0))
+	sysLog.open()
+	defer sysLog.close()
+
+	var logFile *os.File
+	if *logPath != "" {
+		var err error
+		logFile, err = os.OpenFile(*logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		check(err)
+		defer logFile.Close()
+	}
+
+	var metrics *metricsRegistry
+	if *metricsAddr != "" {
+		metrics = newMetricsRegistry()
+		serveMetrics(*metricsAddr, metrics)
+	}
+
+	w, err := newWatcher(dir, *settle)
+	check(err)
+	w.allowTextMissingExtension = *allowTextMissingExtension
+	w.report = func(path string, errors, warns, logs []string) {
+		printFindings(path, errors, warns, logs, *debug)
+		if metrics != nil {
+			metrics.recordWatched(errors, warns)
+		}
+		notify.add(path, errors, warns)
+		sysLog.send(dir, path, errors, warns)
+		if logFile == nil || len(errors)+len(warns) == 0 {
+			return
+		}
+		stamp := time.Now().Format(time.RFC3339)
+		for _, msg := range errors {
+			fmt.Fprintf(logFile, "%s [ERROR] %s: %s\n", stamp, path, msg)
+		}
+		for _, msg := range warns {
+			fmt.Fprintf(logFile, "%s [WARN] %s: %s\n", stamp, path, msg)
+		}
+	}
+	w.afterCheck = func() {
+		notify.flush(fmt.Sprintf("weirdfs watch of %s", dir), "findings on new or changed files", *logPath)
+	}
+	w.addTree(dir, *checkExisting)
+	fmt.Printf("Watching %s (%d directories, %d files)\n", dir, len(w.dirs), len(w.files))
+	check(w.run())
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -38,8 +39,13 @@ var defaultIgnoredPaths = []string{
 	".fseventsd",
 	".Trashes",
 	".Spotlight-V100",
+	quarantineDirName,
 }
 
+// ignoredPathPatterns are extra file or directory name patterns to skip,
+// set with -ignore.
+var ignoredPathPatterns = []string{}
+
 var defaultIgnoredXattrs = []string{
 	"com.apple.FinderInfo",
 	"com.apple.Preview.UIstate.v1",
@@ -117,6 +123,15 @@ func debugMsg(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, format+"\n", args...)
 }
 
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 func uniqueStrings(input []string) []string {
 	u := make([]string, 0, len(input))
 	m := make(map[string]bool)
@@ -131,6 +146,53 @@ func uniqueStrings(input []string) []string {
 	return u
 }
 
+// fileTally accumulates a count and total size of files in some category.
+type fileTally struct {
+	count int
+	size  int64
+}
+
+func (t *fileTally) add(size int64) {
+	t.count++
+	t.size += size
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// parseBytes parses a size like "25MB" or "4.5 GB" (powers of 1024, as
+// formatBytes prints them).
+func parseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	number := strings.TrimRight(strings.TrimSuffix(s, "B"), "KMGTPE ")
+	unit := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, number), "B"))
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	multiplier := int64(1)
+	if unit != "" {
+		exp := strings.Index("KMGTPE", unit)
+		if exp < 0 || len(unit) != 1 {
+			return 0, fmt.Errorf("invalid size %q", s)
+		}
+		for i := 0; i <= exp; i++ {
+			multiplier *= 1024
+		}
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
 func strictFileExtension(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
 	if !validFileExtension.MatchString(ext) {
@@ -157,6 +219,9 @@ func isIgnoredPath(path string) bool {
 				return true
 			}
 		}
+		if matchesAny(ignoredPathPatterns, part) {
+			return true
+		}
 	}
 	return false
 }
@@ -178,7 +243,7 @@ func removeIgnoredXattrs(attrs []string) []string {
 	return filtered
 }
 
-func evaluateXattrs(path string, info os.FileInfo, attrs []string, report *map[string]int, resourceReport *map[string][]string) (logs, warns []string) {
+func evaluateXattrs(path string, info os.FileInfo, attrs []string, report *map[string]int, resourceReport *map[string][]string, resourceBytes *int64) (logs, warns []string) {
 	if len(attrs) > 0 {
 		logs = append(logs, fmt.Sprintf("xattrs: %s", strings.Join(attrs, ", ")))
 	}
@@ -198,6 +263,7 @@ func evaluateXattrs(path string, info os.FileInfo, attrs []string, report *map[s
 					ext = "(no extension)"
 				}
 				(*report)[ext]++
+				*resourceBytes += int64(len(rsrc))
 				(*resourceReport)[ext] = uniqueStrings(append((*resourceReport)[ext], resourceTypes...))
 				if info.Size() == 0 {
 					warns = append(warns, fmt.Sprintf("Data fork is empty; resource fork may contain all data (%d).", len(rsrc)))
@@ -209,6 +275,7 @@ func evaluateXattrs(path string, info os.FileInfo, attrs []string, report *map[s
 }
 
 func extractResourceTypes(path string) ([]string, error) {
+	defer timeCommand("DeRez", time.Now())
 	cmdOut, err := exec.Command("DeRez", path).Output()
 	if err != nil {
 		return nil, err
@@ -237,6 +304,9 @@ func checkBasename(path string, info os.FileInfo, allowTextMissingExtension bool
 			warns = append(warns, fmt.Sprintf("Name contains illegal character '%c'.", char))
 		}
 	}
+	if isCAPEncodedName(base) {
+		warns = append(warns, fmt.Sprintf("netatalk CAP-encoded name (decodes to '%s').", decodeCAPName(base)))
+	}
 	lastRune, _ := utf8.DecodeLastRuneInString(base)
 	for _, illegalRune := range illegalTrailingChars {
 		if lastRune == illegalRune {
@@ -258,6 +328,7 @@ func checkBasename(path string, info os.FileInfo, allowTextMissingExtension bool
 }
 
 func isPlainTextFile(path string) bool {
+	defer timeCommand("file", time.Now())
 	cmdOut, err := exec.Command("file", "-b", path).Output()
 	check(err)
 	out := string(cmdOut)
@@ -269,31 +340,88 @@ func isPlainTextFile(path string) bool {
 	return matched
 }
 
-func copyStrippedFile(path string, info os.FileInfo, attrs []string, dest string, ignoredExtensions []string) ([]string, int) {
-	logs := []string{}
-	count := 0
+// Name of the file mapping stripped copies back to their originals.
+const strippedManifestName = "weirdfs-manifest.csv"
+
+// strippedCopyPath mirrors rel under dest. If the name is taken, e.g. by a
+// file differing only in case on a case-insensitive destination, a number
+// is added before the extension.
+func strippedCopyPath(dest, rel string) string {
+	destPath := filepath.Join(dest, rel)
+	ext := filepath.Ext(destPath)
+	base := strings.TrimSuffix(destPath, ext)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(destPath); os.IsNotExist(err) && destPath != filepath.Join(dest, strippedManifestName) {
+			return destPath
+		}
+		destPath = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+// Buffer size for stripped copies; large enough to keep big media files
+// streaming at disk speed.
+const strippedCopyBufferSize = 1 << 20
+
+// copyDataFork streams the data fork of path to destPath, keeping its
+// permissions and modification time, and returns the bytes copied.
+func copyDataFork(path, destPath string, info os.FileInfo) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyBuffer(dst, src, make([]byte, strippedCopyBufferSize))
+	if err == nil {
+		err = dst.Chmod(info.Mode().Perm())
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Chtimes(destPath, info.ModTime(), info.ModTime())
+}
+
+// copyStrippedFile copies the data fork of a file with a resource fork to
+// the same relative path rel under dest, returning the path of the copy and
+// the bytes copied.
+func copyStrippedFile(path, rel string, info os.FileInfo, attrs []string, dest string, ignoredExtensions []string) (logs []string, copied string, n int64) {
 	fileExt := strictFileExtension(path)
 	for _, ext := range ignoredExtensions {
 		if fileExt == ext {
-			return logs, count
+			return logs, "", 0
 		}
 	}
 	for _, attr := range attrs {
 		if attr == "com.apple.ResourceFork" {
-			rsrc, err := xattr.Get(path, attr)
-			if err != nil || len(rsrc) == 0 {
-				return logs, count
+			// only the size is needed; resource forks can be large too
+			size, err := xattrSize(path, attr)
+			if err != nil || size == 0 {
+				return logs, "", 0
 			}
 
-			destPath := filepath.Join(dest, strings.Replace(path, "/", "__", -1))
-			data, err := ioutil.ReadFile(path)
-			check(err)
-			err = ioutil.WriteFile(destPath, data, 0644)
+			destPath := strippedCopyPath(dest, rel)
+			check(os.MkdirAll(filepath.Dir(destPath), 0755))
+			start := time.Now()
+			n, err := copyDataFork(path, destPath, info)
 			check(err)
-			return append(logs, fmt.Sprintf("Copied data-only version to %s", destPath)), 1
+			return append(logs, fmt.Sprintf("Copied data-only version to %s (%s at %s)", destPath, formatBytes(n), formatThroughput(n, time.Since(start)))), destPath, n
 		}
 	}
-	return logs, count
+	return logs, "", 0
+}
+
+// formatThroughput describes n bytes copied in d as a rate.
+func formatThroughput(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "n/a"
+	}
+	return formatBytes(int64(float64(n)/d.Seconds())) + "/s"
 }
 
 func log(msg, level string) {
@@ -306,10 +434,26 @@ func logMany(msgs []string, level string) {
 	}
 }
 
-func printStatusLine(msg string) {
+func printFindings(path string, errors, warns, logs []string, debug bool) {
+	if len(warns) > 0 || len(errors) > 0 {
+		printStatusLine("")
+		fmt.Println(path)
+		logMany(errors, "error")
+		logMany(warns, "warn")
+		logMany(logs, "info")
+	} else if debug {
+		if len(logs) > 0 {
+			printStatusLine("")
+			debugMsg("%s", path)
+			logMany(logs, "info")
+		}
+	}
+}
+
+// terminalSize returns the width and height of the terminal on stdin.
+func terminalSize() (width, height int, ok bool) {
 	var dimensions [4]uint16
 
-	// probably not very efficient to make this syscall every time but oh well!
 	if _, _, err := syscall.Syscall6(
 		syscall.SYS_IOCTL,
 		uintptr(syscall.Stdin),
@@ -319,38 +463,142 @@ func printStatusLine(msg string) {
 		0,
 		0,
 	); err != 0 {
+		return 0, 0, false
+	}
+	return int(dimensions[1]), int(dimensions[0]), true
+}
+
+func printStatusLine(msg string) {
+	// probably not very efficient to make this syscall every time but oh well!
+	width, _, ok := terminalSize()
+	if !ok {
 		// ignore error
 		return
 	}
 
-	width := int(dimensions[1])
 	// pad to width if shorter, then truncate if longer
 	msg = fmt.Sprintf("%- "+strconv.Itoa(width)+"s", msg)
 	fmt.Fprintf(os.Stderr, "%s\r", msg[:width-1])
 }
 
+// commands maps subcommand names to their entry points; running weirdfs
+// without a subcommand performs a scan.
+var commands = map[string]func(args []string){
+	"export-xattrs":   exportXattrsCommand,
+	"restore-xattrs":  restoreXattrsCommand,
+	"clean":           cleanCommand,
+	"manifest":        manifestCommand,
+	"verify-manifest": verifyManifestCommand,
+	"verify":          verifyCommand,
+	"merge-check":     mergeCheckCommand,
+	"diff":            diffCommand,
+	"fix":             fixCommand,
+	"apply":           applyCommand,
+	"undo":            undoCommand,
+	"browse":          browseCommand,
+	"serve":           serveCommand,
+	"watch":           watchCommand,
+	"daemon":          daemonCommand,
+	"trends":          trendsCommand,
+	"scan-all":        scanAllCommand,
+	"export-zip":      exportZipCommand,
+	"export-excludes": exportExcludesCommand,
+}
+
+// scanRoot resolves a directory argument to an absolute path, defaulting to
+// the working directory.
+func scanRoot(dir string) string {
+	var err error
+	if dir == "" {
+		dir, err = os.Getwd()
+		check(err)
+	}
+	dir, err = filepath.Abs(dir)
+	check(err)
+	return dir
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+	scan()
+}
+
+func scan() {
 	debug := flag.Bool("debug", false, "Output extra debugging info")
 	stripResourceForks := flag.Bool("stripResourceForks", false, "Make a data-only copy of files with resource forks for manual analysis")
 	stripResourceSkip := flag.String("stripResourceSkip", "", "Comma-separated list of file extensions to exclude from manual analysis, e.g. 'crw,jpg'")
 	warnOnCreationTimes := flag.Bool("warnOnCreationTimes", false, "Print warnings on files with creation times that vary from modification times by more than 1 day")
 	allowTextMissingExtension := flag.Bool("allowTextMissingExtension", false, "Allow plain text files without file extension")
+	exportTags := flag.String("exportTags", "", "Write Finder tags of tagged files to this path")
+	exportTagsFormat := flag.String("exportTagsFormat", "csv", "Format for -exportTags: csv, json, or sh (script that re-applies tags)")
+	exportComments := flag.String("exportComments", "", "Decode Finder comments and write them (path -> comment) to this path")
+	exportLabels := flag.String("exportLabels", "", "Write the color labels of files (path -> colors, from the Finder label and tags) to this path")
+	exportLabelsFormat := flag.String("exportLabelsFormat", "csv", "Format for -exportLabels: csv or json")
+	exportCommentsFormat := flag.String("exportCommentsFormat", "csv", "Format for -exportComments: csv or json")
+	reportWhereFroms := flag.Bool("reportWhereFroms", false, "List download URLs and senders recorded in kMDItemWhereFroms")
+	reportBackupExcludes := flag.Bool("reportBackupExcludes", false, "List items excluded from Time Machine (com_apple_backup_excludeItem), with sizes")
+	reportAccessAttrs := flag.Bool("reportAccessAttrs", false, "Look up which applications set com.apple.provenance on files (needs Full Disk Access) and summarize them")
+	reportOwners := flag.Bool("reportOwners", false, "Summarize items and bytes per owning user and group, flagging IDs with no account")
+	reportQuarantine := flag.Bool("reportQuarantine", false, "Decode com.apple.quarantine and summarize quarantined files by originating application")
+	clearQuarantine := flag.Bool("clearQuarantine", false, "Remove com.apple.quarantine from quarantined files (recorded in the undo journal)")
+	ignoreJunk := flag.String("ignoreJunk", "", "Comma-separated junk categories to leave out of per-file output (still summarized): "+junkCategoryNames())
+	removeJunkCategories := flag.String("removeJunk", "", "Comma-separated junk categories to move to "+quarantineDirName+" under the root (revert with 'weirdfs undo'): "+junkCategoryNames())
+	buildDirs := flag.String("buildDirs", strings.Join(defaultBuildArtifactDirs, ","), "Comma-separated directory name patterns treated as regenerable build artifacts")
+	reportRepos := flag.Bool("reportRepos", false, "Report version control checkouts (.git, .svn, .hg) instead of silently skipping their metadata")
+	tempPatterns := flag.String("tempPatterns", "", "Additional comma-separated file name patterns treated as temporary or lock files, e.g. '*.bak,*.lck'")
+	reportTrash := flag.Bool("reportTrash", false, "Report files and bytes in trash directories (.Trashes, .Trash) per user instead of ignoring them")
+	reportPath := flag.String("report", "", "Write a JSON report of the scan to this path (for use with 'weirdfs diff')")
+	tui := flag.Bool("tui", false, "Open the interactive results browser when the scan finishes")
+	mergeAppleDouble := flag.Bool("mergeAppleDouble", false, "Merge AppleDouble (._) files into native xattrs on the file they describe, then move them to "+quarantineDirName+" (revert with 'weirdfs undo')")
+	journalPath := flag.String("journal", "", "Undo journal for -removeJunk, -mergeAppleDouble, and -clearQuarantine (default: weirdfs-undo-<time>.jsonl)")
+	notify := addNotifyFlags(flag.CommandLine)
+	sysLog := addSyslogFlags(flag.CommandLine)
+	scanArchives := flag.Bool("scanArchives", false, "Check the members of zip, tar, tar.gz, and tar.bz2 archives, and whether they hold Mac metadata")
+	target := flag.String("target", "", "Comma-separated destinations to check compatibility with: "+targetProfileNames())
+	dumpXattrValues := flag.Bool("dumpXattrs", false, "Print the values of the xattrs of files with findings, in hex and decoded when they are binary plists or text")
+	maxXattrs := flag.Int("maxXattrs", 20, "Warn when a file has more xattrs than this, not counting ignored ones (0 to disable)")
+	maxXattrSize := flag.String("maxXattrSize", "64KB", "Warn when a single xattr, or a file's xattrs together, are larger than this (0 to disable)")
+	skipOtherVolumes := flag.Bool("skipOtherVolumes", false, "Don't descend into other volumes (disk images, network shares, other APFS volumes) mounted inside the tree")
+	equalMtimes := flag.Bool("equalMtimes", false, "With -target, list files in the same directory whose modification times will become equal once rounded by the target")
+	yearHistogram := flag.Bool("ageHistogram", false, "Print a histogram of file modification and creation years, overall and per extension")
+	topN := flag.Int("top", 0, "List the N largest and N oldest files (0 to disable)")
+	sizeHistogram := flag.Bool("sizeHistogram", false, "Print a histogram and percentiles of file sizes, overall and per extension")
+	extensionSort := flag.String("extensionSort", "bytes", "Column to sort the file extension table by: "+strings.Join(extensionSortColumns, ", "))
+	maxDirEntries := flag.Int("maxDirEntries", 10000, "Warn about directories with more entries than this (0 to disable)")
+	maxFileSize := flag.String("maxFileSize", "", "Comma-separated file size limits to check, as 'label=size' or 'size', e.g. 'email=25MB,wetransfer=2GB'")
+	largeImageGB := flag.Float64("largeImageGB", 4, "Size in GB above which disk and VM images are listed as large opaque blobs")
+	scanImages := flag.Bool("scanImages", false, "Attach .dmg, .sparseimage, and .sparsebundle images read-only with hdiutil and scan their contents")
+	ignorePatterns := flag.String("ignore", "", "Comma-separated file or directory name patterns to skip, e.g. 'Caches,*.photoslibrary'")
+	historyPath := flag.String("history", "", "Append a summary of the scan to this file for 'weirdfs trends', e.g. "+defaultHistoryPath())
+	notifyDone := flag.Bool("notify", false, "Post a Notification Center message when the scan finishes or is aborted")
+	budgetSize := flag.String("budget", "", "Destination quota to compare the total size against, e.g. '200GB'; reports headroom and what could be excluded to fit")
+	budgetExcludeJunk := flag.Bool("budgetExcludeJunk", false, "Leave detected junk and regenerable directories out of the -budget total")
 	flag.Parse()
+	notify.checkLevel()
 
-	dir := flag.Arg(0)
+	dir := scanRoot(flag.Arg(0))
 	var err error
-	if dir == "" {
-		dir, err = os.Getwd()
-		check(err)
+	if !containsString(extensionSortColumns, *extensionSort) {
+		check(fmt.Errorf("unknown -extensionSort column '%s'", *extensionSort))
 	}
-	dir, err = filepath.Abs(dir)
-	check(err)
 
 	fmt.Printf("Scanning %s\n", dir)
+	sysLog.open()
+	defer sysLog.close()
+	if *notifyDone {
+		defer notifyOnAbort(dir)()
+	}
 
 	var strippedDir string = ""
 	stripResourceIgnoredExtensions := []string{}
-	strippedFilesCount := 0
+	strippedCopies := []pathValue{}
+	var strippedBytes int64
+	var strippedTime time.Duration
 	if *stripResourceForks {
 		usr, err := user.Current()
 		check(err)
@@ -382,16 +630,162 @@ func main() {
 	scannedDirs := 0
 	resourceForkTypes := map[string]int{}
 	resourcesByType := make(map[string][]string)
-	fileExtensions := map[string]bool{}
+	var resourceForkBytes int64
+	fileExtensions := extensionStats{}
+	ages := newAgeHistogram()
+	top := topFiles{n: *topN}
+	xattrCensus := map[string]*fileTally{}
+	atRisk := newMetadataRisk()
 	rawScanned := 0
 	scanErrors := 0
+	appleDoubleClutter := map[string]*fileTally{}
+	netatalk := netatalkReport{}
+	taggedFiles := []taggedFile{}
+	tagCounts := map[string]int{}
+	colorCounts := map[string]int{}
+	finderFlagCounts := map[string]int{}
+	bundleMismatches := map[string]int{}
+	colorLabels := []pathValue{}
+	finderComments := []pathValue{}
+	whereFroms := map[string][]string{}
+	quarantineAgents := map[string]int{}
+	backupExclusions := backupExclusionReport{}
+	accessAttrs := newAccessAttrReport(*reportAccessAttrs)
+	syncConflicts := syncConflictReport{kinds: map[string]*fileTally{}}
+	junk := map[string]*fileTally{}
+	vcsRepos := []vcsRepo{}
+	trash := map[string]*fileTally{}
+	report := newScanReport(dir)
+	warningCount := 0
+	findingRules := ruleSummary{}
+	mounts := imageMounts{}
+	sparseBundles := fileTally{}
+	encrypted := map[string]*fileTally{}
+	legacyArchives := map[string]*fileTally{}
+	archivesWithMetadata := fileTally{}
+	cleanArchives := fileTally{}
+	largeBlobs := []largeBlob{}
+	appLibraries := map[string]*fileTally{}
+	symlinks := map[string]int{}
+	specialFiles := map[string]int{}
+	dataless := fileTally{}
+	iCloudPlaceholders := fileTally{}
+	volumeBoundaries := []volumeBoundary{}
+	links := hardLinks{}
+	clones := cloneReport{}
+	sparseFiles := sparseReport{}
+	acls := aclReport{}
+	fileFlagCounts := map[string]int{}
+	permissionCounts := map[string]int{}
+	owners := newOwnerReport()
+	emptyFiles := newEmptyFileReport()
+	timestampProblems := map[string]int{}
+	scanStarted := time.Now()
+	perf := newScanPerformance()
+	// target findings for the path being walked, merged into its output
+	var pendingPath string
+	var pendingLogs, pendingWarns []string
+	emit := func(path string, info os.FileInfo, errors, warns, logs []string) {
+		if path == pendingPath {
+			warns = append(warns, pendingWarns...)
+			logs = append(logs, pendingLogs...)
+			pendingPath = ""
+		}
+		if _, ok := mounts[path]; ok {
+			// the root of an attached image is reported as the image itself
+			info = nil
+		}
+		path = mounts.displayPath(path)
+		printFindings(path, errors, warns, logs, *debug)
+		report.add(path, info, errors, warns, logs)
+		notify.add(path, errors, warns)
+		sysLog.send(dir, path, errors, warns)
+		warningCount += len(errors) + len(warns)
+		var size int64
+		if info != nil && info.Mode().IsRegular() {
+			fileExtensions.addWarnings(path, len(errors)+len(warns))
+			size = info.Size()
+		}
+		findingRules.add(errors, warns, size)
+	}
+	// hold adds findings to the next output for path
+	hold := func(path string, logs, warns []string) {
+		if len(logs)+len(warns) == 0 {
+			return
+		}
+		if pendingPath != path {
+			pendingPath, pendingLogs, pendingWarns = path, nil, nil
+		}
+		pendingLogs = append(pendingLogs, logs...)
+		pendingWarns = append(pendingWarns, warns...)
+	}
+	ignoredPathPatterns = splitList(*ignorePatterns)
+	volumeGroup, err := loadFirmlinks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading firmlinks: %s\n", err)
+	}
+	largeImageSize := int64(*largeImageGB * 1024 * 1024 * 1024)
+	targets := append(parseTargetProfiles(*target), sizeLimitProfiles(*maxFileSize)...)
+	targetTallies := map[string]*targetTally{}
+	xattrSizeLimit, err := parseBytes(*maxXattrSize)
+	check(err)
+	var budget *sizeBudget
+	if *budgetSize != "" {
+		quota, err := parseBytes(*budgetSize)
+		check(err)
+		budget = newSizeBudget(quota, *budgetExcludeJunk)
+	}
+	// spend counts a path against the budget, except inside attached images
+	spend := func(path string, size int64, category string) {
+		if budget != nil && mounts.displayPath(path) == path {
+			budget.add(report.relPath(path), size, category)
+		}
+	}
+	for _, profile := range targets {
+		targetTallies[profile.name] = &targetTally{}
+		if *equalMtimes && profile.mtimeResolution > 0 {
+			targetTallies[profile.name].roundedMtimes = map[string][]mtimeEntry{}
+		}
+	}
+	setJunkPatterns("build", *buildDirs)
+	addJunkFilePatterns("temp", *tempPatterns)
+	ignoredJunk := parseJunkCategories(*ignoreJunk)
+	removedJunk := parseJunkCategories(*removeJunkCategories)
+	var undo, mergeUndo, clearUndo *undoContext
+	if len(removedJunk) > 0 || *mergeAppleDouble || *clearQuarantine {
+		undo = newUndoContext(dir, *journalPath)
+		defer undo.journal.close()
+	}
+	if *mergeAppleDouble {
+		mergeUndo = undo
+	}
+	if *clearQuarantine {
+		clearUndo = undo
+	}
 
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	var walk filepath.WalkFunc
+	walk = func(path string, info os.FileInfo, err error) error {
+		defer perf.timeEntry(mounts.displayPath(filepath.Dir(path)), time.Now())
 		if *debug {
 			debugMsg("Scanning %s", path)
 		}
 		rawScanned++
 
+		if *reportRepos {
+			if repo := detectVCSRepo(path, info); repo != nil {
+				printStatusLine("")
+				fmt.Println(repo.path)
+				log(fmt.Sprintf("%s checkout (%s)", repo.kind, formatBytes(repo.checkoutSize)), "info")
+				vcsRepos = append(vcsRepos, *repo)
+				return filepath.SkipDir
+			}
+		}
+
+		if *reportTrash && isTrashDir(path, info) {
+			tallyTrash(path, info, trash)
+			return filepath.SkipDir
+		}
+
 		// Check ignored list before errors to avoid reporting errors on stuff we would ignore anyway
 		if isIgnoredFile(filepath.Base(path)) {
 			printStatusLine(fmt.Sprintf("%d: (ignored file)", rawScanned))
@@ -405,9 +799,43 @@ func main() {
 
 		if err != nil {
 			scanErrors++
-			printStatusLine("")
-			fmt.Println(path)
-			log(err.Error(), "error")
+			emit(path, info, []string{err.Error()}, []string{}, []string{})
+			return nil
+		}
+
+		if len(targets) > 0 && path != dir {
+			rel := report.relPath(mounts.displayPath(path))
+			attrs, _ := xattr.LList(path)
+			attrs = removeIgnoredXattrs(attrs)
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				link = describeSymlink(path, dir)
+			}
+			pendingPath, pendingLogs, pendingWarns = path, nil, nil
+			for _, profile := range targets {
+				logs, warns := checkTarget(profile, rel, info, attrs, link, targetTallies[profile.name])
+				pendingLogs = append(pendingLogs, logs...)
+				pendingWarns = append(pendingWarns, warns...)
+			}
+			// paths that aren't otherwise reported, like symlinks
+			defer func() {
+				if pendingPath == path {
+					emit(path, info, []string{}, []string{}, []string{})
+				}
+			}()
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			logs, warns, kind := checkSymlink(path, mounts.rootOf(path, dir))
+			symlinks[kind]++
+			emit(path, info, []string{}, warns, logs)
+			return nil
+		}
+
+		if kind := specialFileKind(info); kind != "" {
+			logs, warns := checkSpecialFile(kind)
+			specialFiles[kind]++
+			emit(path, info, []string{}, warns, logs)
 			return nil
 		}
 
@@ -416,12 +844,144 @@ func main() {
 
 			if info.Mode().IsRegular() {
 				scannedFiles++
-				fileExtensions[strictFileExtension(path)] = true
+				perf.BytesExamined += info.Size()
+				if top.n > 0 {
+					top.add(mounts.displayPath(path), info.Size(), info.ModTime())
+				}
+				fileExtensions.add(path, info.Size())
+				if *yearHistogram {
+					ages.add(path, info)
+				}
 			} else {
 				scannedDirs++
 			}
 
+			if info.IsDir() {
+				logs, warns, skip := volumeGroup.check(path, dir)
+				if skip {
+					emit(path, info, []string{}, warns, logs)
+					return filepath.SkipDir
+				}
+				hold(path, logs, warns)
+			}
+
+			if _, attached := mounts[path]; !attached && path != dir && !volumeGroup.isFirmlink(path) && isVolumeBoundary(path, info) {
+				logs, warns := checkVolumeBoundary(path, *skipOtherVolumes, &volumeBoundaries)
+				if *skipOtherVolumes {
+					emit(path, info, []string{}, warns, logs)
+					return filepath.SkipDir
+				}
+				hold(path, logs, warns)
+			}
+
+			if isDataless(info) {
+				logs, warns := checkDataless(info, &dataless)
+				emit(path, info, []string{}, warns, logs)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if isICloudPlaceholder(path, info) {
+				logs, warns := checkICloudPlaceholder(path, &iCloudPlaceholders)
+				emit(path, info, []string{}, warns, logs)
+				return nil
+			}
+
+			if kind := appLibraryKind(path, info); kind != "" {
+				logs, warns, size := checkAppLibrary(path, kind)
+				if appLibraries[kind] == nil {
+					appLibraries[kind] = &fileTally{}
+				}
+				appLibraries[kind].add(size)
+				spend(path, size, "")
+				emit(path, info, []string{}, warns, logs)
+				return filepath.SkipDir
+			}
+
+			if isVMBundle(path, info) {
+				logs, warns, size := checkVMBundle(path, mounts.displayPath(path), largeImageSize, &largeBlobs)
+				spend(path, size, "disk and VM images")
+				emit(path, info, []string{}, warns, logs)
+				return filepath.SkipDir
+			}
+
+			if isSparseBundle(path, info) {
+				logs, warns, kind := checkEncrypted(path, info)
+				logs2, warns2, size := checkSparseBundle(path, mounts, walk, *scanImages && kind == "")
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				logs2, warns2 = checkLargeImage(mounts.displayPath(path), size, largeImageSize, &largeBlobs)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				sparseBundles.add(size)
+				spend(path, size, "disk and VM images")
+				if kind != "" {
+					if encrypted[kind] == nil {
+						encrypted[kind] = &fileTally{}
+					}
+					encrypted[kind].add(size)
+				}
+				emit(path, info, []string{}, warns, logs)
+				return filepath.SkipDir
+			}
+
+			if category := matchJunk(path, info); category != nil {
+				logs, warns, size := checkJunk(path, info, category)
+				if junk[category.name] == nil {
+					junk[category.name] = &fileTally{}
+				}
+				junk[category.name].add(size)
+				if removedJunk[category.name] {
+					logs2, warns2 := removeJunk(path, category, undo)
+					logs = append(logs, logs2...)
+					warns = append(warns, warns2...)
+				} else {
+					spend(path, size, "junk: "+category.name)
+				}
+				if !ignoredJunk[category.name] {
+					emit(path, info, []string{}, warns, logs)
+				}
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if info.IsDir() && isNetatalkArtifact(filepath.Base(path)) {
+				logs, warns := checkNetatalkDir(path, mergeUndo, &netatalk)
+				emit(path, info, []string{}, warns, logs)
+				return filepath.SkipDir
+			}
+
+			if info.Mode().IsRegular() && isAppleDoubleName(filepath.Base(path)) {
+				logs, warns, status := checkAppleDouble(path, info, mergeUndo)
+				if status != "" {
+					if appleDoubleClutter[status] == nil {
+						appleDoubleClutter[status] = &fileTally{}
+					}
+					appleDoubleClutter[status].add(info.Size())
+				}
+				spend(path, info.Size(), "AppleDouble files")
+				emit(path, info, []string{}, warns, logs)
+				return nil
+			}
+
 			logs, warns := checkBasename(path, info, *allowTextMissingExtension)
+			if info.Mode().IsRegular() {
+				logs2, warns2 := checkSyncConflict(path, info, &syncConflicts)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+			}
+			if info.IsDir() {
+				logs2, warns2 := checkNearDuplicates(path)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				logs2, warns2 = checkDirEntries(path, *maxDirEntries)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+			}
 			errors := []string{}
 
 			xattrNames, err := xattr.List(path)
@@ -429,17 +989,152 @@ func main() {
 				errors = append(errors, err.Error())
 			}
 
+			allXattrNames := xattrNames
 			xattrNames = removeIgnoredXattrs(xattrNames)
-			logs2, warns2 := evaluateXattrs(path, info, xattrNames, &resourceForkTypes, &resourcesByType)
+			logs2, warns2 := evaluateXattrs(path, info, xattrNames, &resourceForkTypes, &resourcesByType, &resourceForkBytes)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2, xattrSizes := checkXattrSizes(path, xattrNames, xattrSizeLimit)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+			for name, size := range xattrSizes {
+				if xattrCensus[name] == nil {
+					xattrCensus[name] = &fileTally{}
+				}
+				xattrCensus[name].add(size)
+			}
+			atRisk.add(path, xattrSizes)
+			for _, profile := range targets {
+				targetTallies[profile.name].addXattrs(xattrSizes)
+			}
+
+			logs2, warns2 = checkXattrCount(xattrNames, *maxXattrs)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2, tagged := checkFinderTags(path, xattrNames)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+			if tagged != nil {
+				taggedFiles = append(taggedFiles, *tagged)
+				for _, tag := range tagged.Tags {
+					tagCounts[tag.String()]++
+				}
+			}
+
+			logs2, warns2, colors := checkColorLabels(path, info, allXattrNames, tagged, colorCounts)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+			if len(colors) > 0 {
+				colorLabels = append(colorLabels, pathValue{path, strings.Join(colors, ",")})
+			}
+
+			logs2, warns2 = checkLocked(path, info, allXattrNames)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = checkInvisible(path, info, allXattrNames)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = checkFinderFlags(path, info, allXattrNames, finderFlagCounts)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = checkBundleBit(path, info, allXattrNames, bundleMismatches)
 			logs = append(logs, logs2...)
 			warns = append(warns, warns2...)
 
+			logs2, warns2 = checkPermissions(path, info, permissionCounts)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = owners.checkOwner(info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = checkFileFlags(info, fileFlagCounts)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = acls.checkACL(path, info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = accessAttrs.checkAccessAttrs(path, allXattrNames)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			if *exportComments != "" {
+				logs2, warns2, comment := checkFinderComment(path, allXattrNames)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				if comment != "" {
+					finderComments = append(finderComments, pathValue{path, comment})
+				}
+			}
+
+			if *reportWhereFroms {
+				logs2, warns2, sources := checkWhereFroms(path, allXattrNames)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				if len(sources) > 0 {
+					whereFroms[path] = sources
+				}
+			}
+
+			if *reportBackupExcludes {
+				logs2, warns2 := backupExclusions.checkBackupExclusion(path, mounts.displayPath(path), info, allXattrNames)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+			}
+
+			if *reportQuarantine || *clearQuarantine {
+				logs2, warns2, quarantine := checkQuarantine(path, allXattrNames, clearUndo)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				if quarantine != nil {
+					quarantineAgents[quarantine.agent]++
+				}
+			}
+
 			if *stripResourceForks {
-				logs2, copied := copyStrippedFile(path, info, xattrNames, strippedDir, stripResourceIgnoredExtensions)
-				strippedFilesCount += copied
+				start := time.Now()
+				logs2, copied, n := copyStrippedFile(path, report.relPath(mounts.displayPath(path)), info, xattrNames, strippedDir, stripResourceIgnoredExtensions)
+				strippedBytes += n
+				strippedTime += time.Since(start)
+				if copied != "" {
+					rel, _ := filepath.Rel(strippedDir, copied)
+					strippedCopies = append(strippedCopies, pathValue{rel, mounts.displayPath(path)})
+				}
 				logs = append(logs, logs2...)
 			}
 
+			logs2, warns2 = emptyFiles.checkEmptyFile(mounts.displayPath(path), info, allXattrNames)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = links.checkHardLink(path, mounts.displayPath(path), info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = clones.checkClone(path, info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = sparseFiles.checkSparse(info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = checkFutureTimes(info, scanStarted, timestampProblems)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
+			logs2, warns2 = checkOldTimes(info, timestampProblems)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+
 			if *warnOnCreationTimes {
 				stat := info.Sys().(*syscall.Stat_t)
 				birthtime := time.Unix(stat.Birthtimespec.Sec, stat.Birthtimespec.Nsec)
@@ -448,29 +1143,95 @@ func main() {
 				}
 			}
 
-			if len(warns) > 0 || len(errors) > 0 {
-				printStatusLine("")
-				fmt.Println(path)
-				logMany(errors, "error")
-				logMany(warns, "warn")
-				logMany(logs, "info")
-			} else if *debug {
-				if len(logs) > 0 {
-					printStatusLine("")
-					debugMsg("%s", path)
-					logMany(logs, "info")
+			logs2, warns2, encryption := checkEncrypted(path, info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+			if encryption != "" {
+				if encrypted[encryption] == nil {
+					encrypted[encryption] = &fileTally{}
 				}
+				encrypted[encryption].add(info.Size())
+			}
+
+			if isLargeImageCandidate(path, info) {
+				logs2, warns2 := checkLargeImage(mounts.displayPath(path), info.Size(), largeImageSize, &largeBlobs)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				spend(path, info.Size(), "disk and VM images")
+			} else if info.Mode().IsRegular() {
+				spend(path, info.Size(), "")
 			}
+
+			logs2, warns2, legacy := checkLegacyArchive(path, info)
+			logs = append(logs, logs2...)
+			warns = append(warns, warns2...)
+			if legacy != "" {
+				if legacyArchives[legacy] == nil {
+					legacyArchives[legacy] = &fileTally{}
+				}
+				legacyArchives[legacy].add(info.Size())
+			}
+
+			var members []archiveMember
+			if *scanArchives && info.Mode().IsRegular() && isArchive(path) {
+				logs2, warns2, archiveMembers, metadata := checkArchive(path)
+				members = archiveMembers
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+				if metadata.any() {
+					archivesWithMetadata.add(info.Size())
+				} else {
+					cleanArchives.add(info.Size())
+				}
+			}
+
+			if *dumpXattrValues && len(errors)+len(warns) > 0 {
+				logs = append(logs, dumpXattrs(path, allXattrNames)...)
+			}
+
+			// like sparse bundles, the image is reported once, after its
+			// contents, with any attach or detach errors
+			if *scanImages && info.Mode().IsRegular() && isDiskImage(path) && encryption == "" {
+				logs2, warns2 := scanImage(path, mounts, walk)
+				logs = append(logs, logs2...)
+				warns = append(warns, warns2...)
+			}
+
+			emit(path, info, errors, warns, logs)
+			scanArchiveMembers(path, members, emit)
 		}
 
 		return nil
-	})
+	}
+	err = filepath.Walk(dir, walk)
 
 	check(err)
 
 	// clear status line
 	printStatusLine("")
+	report.Files = scannedFiles
+	report.Dirs = scannedDirs
+	report.Errors = scanErrors
+	report.ResourceForks = resourceForkTypes
+	report.ResourceForkBytes = resourceForkBytes
+	report.Extensions = fileExtensions.table(*extensionSort)
+	perf.finish(scanStarted, scannedFiles)
+	report.Performance = perf
+	if *reportPath != "" {
+		check(report.write(*reportPath))
+	}
+	notify.flush(fmt.Sprintf("weirdfs scan of %s", dir), "findings", *reportPath)
+	if *historyPath != "" {
+		report.Finished = time.Now().UTC()
+		if err := appendHistory(*historyPath, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error recording scan history: %s\n", err)
+		}
+	}
 	fmt.Printf("\nScanned %d directories and %d files. %d scan errors.\n", scannedDirs, scannedFiles, scanErrors)
+	perf.print()
+	if len(findingRules) > 0 {
+		findingRules.print()
+	}
 	if len(resourceForkTypes) > 0 {
 		fmt.Println("\nTypes with resource forks (lowercased):")
 		exts := make([]string, len(resourceForkTypes))
@@ -488,18 +1249,264 @@ func main() {
 			fmt.Printf("    %s: %d (%s)   %s\n", ext, count, types, warning)
 		}
 	}
+	if len(appleDoubleClutter) > 0 {
+		fmt.Println("\nAppleDouble clutter:")
+		for _, status := range []string{appleDoubleOrphaned, appleDoubleStale} {
+			if tally, ok := appleDoubleClutter[status]; ok {
+				fmt.Printf("    %s: %d files (%s)\n", status, tally.count, formatBytes(tally.size))
+			}
+		}
+	}
+	if sparseBundles.count > 0 {
+		fmt.Printf("\nSparse bundles: %d (%s in bands)\n", sparseBundles.count, formatBytes(sparseBundles.size))
+	}
+	if len(encrypted) > 0 {
+		fmt.Println("\nEncrypted images and containers (contents not audited):")
+		for _, kind := range []string{encryptedImage, encryptedBundle, encryptedContainer} {
+			if tally, ok := encrypted[kind]; ok {
+				fmt.Printf("    %s: %d (%s)\n", kind, tally.count, formatBytes(tally.size))
+			}
+		}
+	}
+	if archivesWithMetadata.count+cleanArchives.count > 0 {
+		fmt.Printf("\nArchives: %d hold Mac metadata that non-Mac tools would drop (%s); %d are clean (%s).\n",
+			archivesWithMetadata.count, formatBytes(archivesWithMetadata.size), cleanArchives.count, formatBytes(cleanArchives.size))
+	}
+	if len(appLibraries) > 0 {
+		fmt.Println("\nApplication libraries (copy only as a whole):")
+		kinds := make([]string, 0, len(appLibraries))
+		for kind := range appLibraries {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Printf("    %s: %d (%s)\n", kind, appLibraries[kind].count, formatBytes(appLibraries[kind].size))
+		}
+	}
+	if len(largeBlobs) > 0 {
+		printLargeBlobs(largeBlobs)
+	}
+	if len(links) > 0 {
+		links.print()
+	}
+	if emptyFiles.count > 0 {
+		emptyFiles.print()
+	}
+	if len(timestampProblems) > 0 {
+		fmt.Println("\nTimestamp problems:")
+		for _, field := range sortedKeys(timestampProblems) {
+			fmt.Printf("    %s: %d\n", field, timestampProblems[field])
+		}
+	}
+	if len(volumeBoundaries) > 0 {
+		printVolumeBoundaries(volumeBoundaries)
+	}
+	if dataless.count > 0 {
+		fmt.Printf("\nDataless (online-only) items: %d, %s nominal size; download them before archiving or copying the tree.\n", dataless.count, formatBytes(dataless.size))
+	}
+	if iCloudPlaceholders.count > 0 {
+		fmt.Printf("\niCloud Drive placeholders: %d evicted files, %s; download them before archiving or copying the tree.\n", iCloudPlaceholders.count, formatBytes(iCloudPlaceholders.size))
+	}
+	if len(specialFiles) > 0 {
+		fmt.Println("\nSpecial files:")
+		for _, kind := range sortedKeys(specialFiles) {
+			fmt.Printf("    %s: %d\n", kind, specialFiles[kind])
+		}
+	}
+	if clones.files > 0 {
+		clones.print()
+	}
+	if sparseFiles.files > 0 {
+		sparseFiles.print()
+	}
+	if acls.objects > 0 {
+		acls.print()
+	}
+	if len(permissionCounts) > 0 {
+		fmt.Println("\nRisky permissions:")
+		for _, rule := range sortedKeys(permissionCounts) {
+			fmt.Printf("    %s: %d\n", rule, permissionCounts[rule])
+		}
+	}
+	if *reportOwners {
+		owners.printDistribution()
+	} else if len(owners.unknown) > 0 {
+		owners.print()
+	}
+	if len(finderFlagCounts) > 0 {
+		fmt.Println("\nFinder flags that stop working once FinderInfo is stripped:")
+		for _, name := range sortedKeys(finderFlagCounts) {
+			fmt.Printf("    %s: %d\n", name, finderFlagCounts[name])
+		}
+	}
+	if len(bundleMismatches) > 0 {
+		fmt.Println("\nBundle bit mismatches:")
+		for _, name := range sortedKeys(bundleMismatches) {
+			fmt.Printf("    %s: %d\n", name, bundleMismatches[name])
+		}
+	}
+	if len(fileFlagCounts) > 0 {
+		fmt.Println("\nBSD file flags:")
+		for _, name := range sortedKeys(fileFlagCounts) {
+			fmt.Printf("    %s: %d\n", name, fileFlagCounts[name])
+		}
+	}
+	if len(symlinks) > 0 {
+		fmt.Println("\nSymbolic links:")
+		for _, kind := range sortedKeys(symlinks) {
+			fmt.Printf("    %s: %d\n", kind, symlinks[kind])
+		}
+	}
+	if budget != nil {
+		budget.print()
+	}
+	if len(legacyArchives) > 0 {
+		fmt.Println("\nLegacy Mac archives (need extraction with StuffIt Expander or similar):")
+		kinds := make([]string, 0, len(legacyArchives))
+		for kind := range legacyArchives {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Printf("    %s: %d (%s)\n", kind, legacyArchives[kind].count, formatBytes(legacyArchives[kind].size))
+		}
+	}
+	if netatalk.artifacts.count > 0 {
+		fmt.Printf("\nnetatalk artifacts: %d directories (%s); %d files have metadata in .AppleDouble, %d orphaned entries.\n",
+			netatalk.artifacts.count, formatBytes(netatalk.artifacts.size), netatalk.withData, netatalk.orphaned)
+	}
+	if len(tagCounts) > 0 {
+		fmt.Printf("\nFinder tags on %d files:\n", len(taggedFiles))
+		tags := make([]string, 0, len(tagCounts))
+		for tag := range tagCounts {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			fmt.Printf("    %s: %d\n", tag, tagCounts[tag])
+		}
+	}
+	if len(colorCounts) > 0 {
+		fmt.Printf("\nColor labels on %d files:\n", len(colorLabels))
+		for _, color := range finderTagColors[1:] {
+			if colorCounts[color] > 0 {
+				fmt.Printf("    %s: %d\n", color, colorCounts[color])
+			}
+		}
+	}
+	if *exportLabels != "" {
+		check(exportPathValues(colorLabels, *exportLabels, *exportLabelsFormat, "colors"))
+		fmt.Printf("\nExported color labels for %d files to %s\n", len(colorLabels), *exportLabels)
+	}
+	if *exportTags != "" {
+		check(exportFinderTags(taggedFiles, *exportTags, *exportTagsFormat))
+		fmt.Printf("\nExported Finder tags for %d files to %s\n", len(taggedFiles), *exportTags)
+	}
+	if *exportComments != "" {
+		check(exportPathValues(finderComments, *exportComments, *exportCommentsFormat, "comment"))
+		fmt.Printf("\nExported %d Finder comments to %s\n", len(finderComments), *exportComments)
+	}
+	if *reportWhereFroms {
+		fmt.Printf("\nDownload provenance (kMDItemWhereFroms) for %d files:\n", len(whereFroms))
+		paths := make([]string, 0, len(whereFroms))
+		for path := range whereFroms {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Printf("    %s\n", path)
+			for _, source := range whereFroms[path] {
+				fmt.Printf("        %s\n", source)
+			}
+		}
+	}
+	if len(accessAttrs.attrs) > 0 {
+		accessAttrs.print()
+	}
+	if *reportBackupExcludes {
+		backupExclusions.print()
+	}
+	if len(quarantineAgents) > 0 {
+		verb := "Quarantined"
+		if *clearQuarantine {
+			verb = "Cleared quarantine on"
+		}
+		fmt.Printf("\n%s files by originating application:\n", verb)
+		agents := make([]string, 0, len(quarantineAgents))
+		for agent := range quarantineAgents {
+			agents = append(agents, agent)
+		}
+		sort.Strings(agents)
+		for _, agent := range agents {
+			fmt.Printf("    %s: %d\n", agent, quarantineAgents[agent])
+		}
+	}
+	if len(syncConflicts.kinds) > 0 {
+		fmt.Println("\nSync conflict artifacts:")
+		for _, kind := range []string{syncConflictedCopy, syncNumberedCopy, syncDropboxTemp} {
+			if tally, ok := syncConflicts.kinds[kind]; ok {
+				fmt.Printf("    %s: %d files (%s)\n", kind, tally.count, formatBytes(tally.size))
+			}
+		}
+		fmt.Printf("    %d copies identical to their original, %d conflicted copies without an original\n", syncConflicts.identical, syncConflicts.orphaned)
+	}
+	if *reportRepos {
+		printVCSRepos(vcsRepos)
+	}
+	if *reportTrash {
+		printTrashReport(trash)
+	}
+	if len(junk) > 0 {
+		fmt.Println("\nJunk (cleanup candidates):")
+		for _, category := range junkCategories {
+			if tally, ok := junk[category.name]; ok {
+				removed := ""
+				if removedJunk[category.name] {
+					removed = " (moved to " + quarantineDirName + ")"
+				}
+				fmt.Printf("    %s (%s): %d items, %s%s\n", category.name, category.description, tally.count, formatBytes(tally.size), removed)
+			}
+		}
+	}
+	if len(targets) > 0 {
+		printTargetReport(targets, targetTallies)
+	}
 	if *stripResourceForks {
-		fmt.Printf("\nStripped resource forks from %d files in %s for analysis.\n", strippedFilesCount, strippedDir)
+		manifest := filepath.Join(strippedDir, strippedManifestName)
+		check(exportPathValues(strippedCopies, manifest, "csv", "original"))
+		fmt.Printf("\nStripped resource forks from %d files in %s for analysis; %s maps the copies to the originals.\n", len(strippedCopies), strippedDir, strippedManifestName)
+		fmt.Printf("Copied %s at %s.\n", formatBytes(strippedBytes), formatThroughput(strippedBytes, strippedTime))
 	}
 	if len(fileExtensions) > 0 {
-		fmt.Println("\nFile extensions encountered (lowercased):")
-		exts := make([]string, len(fileExtensions))
-		i := 0
-		for ext, _ := range fileExtensions {
-			exts[i] = ext
-			i++
+		printExtensionStats(report.Extensions)
+	}
+	if top.n > 0 && scannedFiles > 0 {
+		top.print()
+	}
+	if *sizeHistogram && scannedFiles > 0 {
+		printSizeDistribution(fileExtensions)
+	}
+	if *yearHistogram && scannedFiles > 0 {
+		ages.print()
+	}
+	if len(xattrCensus) > 0 {
+		fmt.Println("\nXattrs encountered (not counting ignored ones):")
+		names := make([]string, 0, len(xattrCensus))
+		for name := range xattrCensus {
+			names = append(names, name)
 		}
-		sort.Strings(exts)
-		fmt.Println(strings.TrimSpace(strings.Join(exts, " ")))
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("    %s: %d files (%s)\n", name, xattrCensus[name].count, formatBytes(xattrCensus[name].size))
+		}
+	}
+	if atRisk.files > 0 {
+		atRisk.print(xattrCensus)
+	}
+	if *notifyDone {
+		postNotification("weirdfs scan finished", fmt.Sprintf("Scanned %d files in %s: %d warnings, %d scan errors.", scannedFiles, dir, warningCount, scanErrors))
+	}
+	if *tui {
+		browseReport(report)
 	}
 }
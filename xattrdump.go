@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/xattr"
+)
+
+// dumpedXattrBytes is how much of each value is shown in hex.
+const dumpedXattrBytes = 64
+
+// isPrintableText reports whether data is UTF-8 text worth showing as is.
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range strings.TrimRight(string(data), "\x00") {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeXattrValue shows the start of a value in hex, decoded as well when
+// it is a binary plist or UTF-8 text.
+func describeXattrValue(value []byte) string {
+	shown := value
+	if len(shown) > dumpedXattrBytes {
+		shown = shown[:dumpedXattrBytes]
+	}
+	description := hex.EncodeToString(shown)
+	if len(value) > len(shown) {
+		description += fmt.Sprintf("... (%d bytes)", len(value))
+	}
+	if isBinaryPlist(value) {
+		if decoded, err := parseBinaryPlist(value); err == nil {
+			if text, err := json.Marshal(decoded); err == nil {
+				description += fmt.Sprintf("; plist %s", text)
+			}
+		}
+	} else if len(value) > 0 && isPrintableText(value) {
+		description += fmt.Sprintf("; text %q", strings.TrimRight(string(value), "\x00"))
+	}
+	return description
+}
+
+// dumpXattrs describes the values of a file's xattrs, so an unfamiliar
+// attribute can be judged without running xattr -l. Resource forks are left
+// to the resource fork checks.
+func dumpXattrs(path string, names []string) (logs []string) {
+	for _, name := range names {
+		if name == "com.apple.ResourceFork" {
+			continue
+		}
+		value, err := xattr.LGet(path, name)
+		if err != nil {
+			logs = append(logs, fmt.Sprintf("Xattr %s: error: %s", name, err))
+			continue
+		}
+		logs = append(logs, fmt.Sprintf("Xattr %s: %s", name, describeXattrValue(value)))
+	}
+	return logs
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/xattr"
+)
+
+const defaultXattrManifest = "weirdfs-xattrs.json"
+
+// xattrManifest is the sidecar written by export-xattrs. Values are stored as
+// base64 (the encoding/json default for []byte).
+type xattrManifest struct {
+	Root  string               `json:"root"`
+	Files []xattrManifestEntry `json:"files"`
+}
+
+type xattrManifestEntry struct {
+	Path   string            `json:"path"`
+	Xattrs map[string][]byte `json:"xattrs"`
+}
+
+// walkScannable walks dir like the scan does, skipping ignored files and paths
+// and anything that is not a regular file or directory.
+func walkScannable(dir string, fn func(path string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if isIgnoredFile(filepath.Base(path)) || isIgnoredPath(path) {
+			return nil
+		}
+		if err != nil {
+			fmt.Println(path)
+			log(err.Error(), "error")
+			return nil
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		return fn(path, info)
+	})
+}
+
+func exportXattrsCommand(args []string) {
+	flags := flag.NewFlagSet("export-xattrs", flag.ExitOnError)
+	output := flags.String("output", defaultXattrManifest, "Path of the xattr manifest to write")
+	flags.Parse(args)
+
+	dir := scanRoot(flags.Arg(0))
+	manifest := xattrManifest{Root: dir, Files: []xattrManifestEntry{}}
+	attrCount := 0
+
+	err := walkScannable(dir, func(path string, info os.FileInfo) error {
+		names, err := xattr.List(path)
+		if err != nil {
+			fmt.Println(path)
+			log(err.Error(), "error")
+			return nil
+		}
+		names = removeIgnoredXattrs(names)
+		if len(names) == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		check(err)
+		entry := xattrManifestEntry{Path: rel, Xattrs: map[string][]byte{}}
+		for _, name := range names {
+			value, err := xattr.Get(path, name)
+			if err != nil {
+				fmt.Println(path)
+				log(err.Error(), "error")
+				continue
+			}
+			entry.Xattrs[name] = value
+			attrCount++
+		}
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	})
+	check(err)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	check(err)
+	check(ioutil.WriteFile(*output, data, 0644))
+	fmt.Printf("Exported %d xattrs from %d files to %s\n", attrCount, len(manifest.Files), *output)
+}
+
+func restoreXattrsCommand(args []string) {
+	flags := flag.NewFlagSet("restore-xattrs", flag.ExitOnError)
+	input := flags.String("input", defaultXattrManifest, "Path of the xattr manifest to restore from")
+	flags.Parse(args)
+
+	dir := scanRoot(flags.Arg(0))
+	data, err := ioutil.ReadFile(*input)
+	check(err)
+	var manifest xattrManifest
+	check(json.Unmarshal(data, &manifest))
+
+	restored := 0
+	failures := 0
+	for _, entry := range manifest.Files {
+		path := filepath.Join(dir, entry.Path)
+		for name, value := range entry.Xattrs {
+			if err := xattr.Set(path, name, value); err != nil {
+				fmt.Println(path)
+				log(err.Error(), "error")
+				failures++
+				continue
+			}
+			restored++
+		}
+	}
+	fmt.Printf("Restored %d xattrs under %s. %d failures.\n", restored, dir, failures)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// getxattr(2) option from <sys/xattr.h>
+const xattrNoFollow = 0x0001
+
+// xattrSize returns the size of an xattr's value without reading it, which
+// matters for resource forks.
+func xattrSize(path, name string) (int64, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	size, _, errno := syscall.Syscall6(
+		syscall.SYS_GETXATTR,
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(n)),
+		0, 0, 0,
+		xattrNoFollow,
+	)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int64(size), nil
+}
+
+// checkXattrSizes lists the size of each xattr and warns when one, or all of
+// them together, exceed max, since SMB, rsync, and most cloud providers
+// truncate or drop large xattrs. Resource forks are left to the resource
+// fork checks. It returns the sizes by name.
+func checkXattrSizes(path string, names []string, max int64) (logs, warns []string, sizes map[string]int64) {
+	sizes = map[string]int64{}
+	if len(names) == 0 {
+		return logs, warns, sizes
+	}
+	described := []string{}
+	var total int64
+	counted := 0
+	for _, name := range names {
+		size, err := xattrSize(path, name)
+		if err != nil {
+			warns = append(warns, fmt.Sprintf("Error reading xattr '%s': %s", name, err))
+			continue
+		}
+		sizes[name] = size
+		described = append(described, fmt.Sprintf("%s (%s)", name, formatBytes(size)))
+		if name == "com.apple.ResourceFork" {
+			continue
+		}
+		total += size
+		counted++
+		if max > 0 && size > max {
+			warns = append(warns, fmt.Sprintf("Large xattr '%s' (%s, over %s); it may be truncated or dropped by SMB, rsync, and cloud storage.", name, formatBytes(size), formatBytes(max)))
+		}
+	}
+	logs = append(logs, fmt.Sprintf("Xattr sizes: %s", strings.Join(described, ", ")))
+	if max > 0 && total > max && counted > 1 {
+		warns = append(warns, fmt.Sprintf("Large total xattr payload (%s, over %s); it may be truncated or dropped by SMB, rsync, and cloud storage.", formatBytes(total), formatBytes(max)))
+	}
+	return logs, warns, sizes
+}
+
+// checkXattrCount warns about files with more than max xattrs, usually
+// accumulated by sync clients or virus scanners, which slow copies down and
+// often mark a problem file.
+func checkXattrCount(names []string, max int) (logs, warns []string) {
+	if max > 0 && len(names) > max {
+		warns = append(warns, fmt.Sprintf("Too many xattrs (%d, over %d); copying them slows transfers, and they often point to a misbehaving sync client or scanner.", len(names), max))
+	}
+	return logs, warns
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addZipFile stores path in the zip as name, with its metadata in a
+// __MACOSX/._name AppleDouble entry as ditto and the Finder's Compress do,
+// so it survives the trip through other filesystems.
+func addZipFile(zw *zip.Writer, path, name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	ad, err := readNativeAppleDouble(path)
+	if err != nil || ad.isEmpty() {
+		return err
+	}
+	adHeader := &zip.FileHeader{
+		Name:   filepath.ToSlash(filepath.Join(macOSXDir, filepath.Dir(name), appleDoublePrefix+filepath.Base(name))),
+		Method: zip.Deflate,
+	}
+	adHeader.Modified = info.ModTime()
+	w, err = zw.CreateHeader(adHeader)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(ad.encode())
+	return err
+}
+
+// flaggedFiles returns the files in a report with findings, optionally only
+// those with a finding whose rule contains rule.
+func flaggedFiles(report *scanReport, rule string) []string {
+	paths := []string{}
+	for _, entry := range report.Entries {
+		if entry.Dir {
+			continue
+		}
+		for _, msg := range entry.findings() {
+			if rule == "" || strings.Contains(strings.ToLower(findingRule(msg)), strings.ToLower(rule)) {
+				paths = append(paths, entry.Path)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+func exportZipCommand(args []string) {
+	flags := flag.NewFlagSet("export-zip", flag.ExitOnError)
+	output := flags.String("output", "weirdfs-flagged.zip", "Path of the zip to write")
+	rule := flags.String("rule", "", "Only export files with a finding whose rule contains this text, e.g. 'illegal character'")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: weirdfs export-zip [-output file] [-rule text] <report.json>")
+		os.Exit(2)
+	}
+	report := readScanReport(flags.Arg(0))
+
+	f, err := os.Create(*output)
+	check(err)
+	zw := zip.NewWriter(f)
+	exported := 0
+	for _, rel := range flaggedFiles(report, *rule) {
+		path := filepath.Join(report.Root, rel)
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			// e.g. archive members or files removed since the scan
+			fmt.Printf("Skipping %s\n", rel)
+			continue
+		}
+		if err := addZipFile(zw, path, rel, info); err != nil {
+			fmt.Println(path)
+			log(fmt.Sprintf("Error: %s", err), "error")
+			continue
+		}
+		exported++
+	}
+	check(zw.Close())
+	check(f.Close())
+	fmt.Printf("Exported %d flagged files with their metadata to %s\n", exported, *output)
+}